@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// minStringBudget is the shortest length --max-tokens cuts strings to.
+const minStringBudget = 8
+
+// fitTokens renders v as TOON in at most budget tokens, with the array
+// styles chosen by --optimize if any. If the full document is too large,
+// every array is trimmed to the largest row count that fits; if one row
+// per array is still too large, long strings are cut as well. Both limits
+// are found by binary search, so the same input and budget always give
+// the same output. It also returns the number of elements kept of each
+// array, as in EncodeOptions.MaxItems, or 0 if none were trimmed.
+func fitTokens(v interface{}, budget int, tok tokenizer.Tokenizer, arrays map[string]toon.ArrayStyle) (string, int, error) {
+	encode := func(items, chars int) (string, int, error) {
+		s, err := toon.Encode(v, &toon.EncodeOptions{MaxItems: items, MaxString: chars, Arrays: arrays})
+		return s, tok.Count(s), err
+	}
+	fits := func(items, chars int) bool {
+		_, n, err := encode(items, chars)
+		return err == nil && n <= budget
+	}
+
+	s, n, err := encode(0, 0)
+	if err != nil || n <= budget {
+		return s, 0, err
+	}
+	longestArray, longestString := extent(v)
+	if longestArray > 1 {
+		if items := largest(1, longestArray-1, func(k int) bool { return fits(k, 0) }); items > 0 {
+			s, _, err := encode(items, 0)
+			return s, items, err
+		}
+	}
+	if longestString > minStringBudget {
+		if chars := largest(minStringBudget, longestString-1, func(k int) bool { return fits(1, k) }); chars > 0 {
+			s, _, err := encode(1, chars)
+			return s, 1, err
+		}
+	}
+	_, n, _ = encode(1, 0)
+	if _, cut, _ := encode(1, minStringBudget); cut < n {
+		n = cut
+	}
+	return "", 0, fmt.Errorf("cannot fit the result in %d tokens (at least %d are needed)", budget, n)
+}
+
+// largest returns the largest k in [lo, hi] for which fits(k) holds,
+// assuming fits holds up to some k and not beyond it, or 0 if there is
+// none.
+func largest(lo, hi int, fits func(int) bool) int {
+	i := sort.Search(hi-lo+1, func(i int) bool { return !fits(lo + i) })
+	if i == 0 {
+		return 0
+	}
+	return lo + i - 1
+}
+
+// extent returns the length of the longest array and the longest string
+// in v, counting strings in characters.
+func extent(v interface{}) (longestArray, longestString int) {
+	switch v := v.(type) {
+	case *toon.Object:
+		for _, k := range v.Keys() {
+			val, _ := v.Get(k)
+			a, s := extent(val)
+			longestArray, longestString = max(longestArray, a), max(longestString, s)
+		}
+	case []interface{}:
+		longestArray = len(v)
+		for _, item := range v {
+			a, s := extent(item)
+			longestArray, longestString = max(longestArray, a), max(longestString, s)
+		}
+	case string:
+		longestString = utf8.RuneCountInString(v)
+	}
+	return longestArray, longestString
+}
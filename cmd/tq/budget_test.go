@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+func TestFitTokens(t *testing.T) {
+	var rows []string
+	for i := 1; i <= 40; i++ {
+		rows = append(rows, fmt.Sprintf(`{"id":%d,"name":"user%d"}`, i, i))
+	}
+	users := `{"users":[` + strings.Join(rows, ",") + `]}`
+	bio := `{"id":1,"bio":"` + strings.Repeat("word ", 60) + `"}`
+
+	tests := []struct {
+		name    string
+		input   string
+		budget  int
+		want    string
+		items   int
+		wantErr string
+	}{
+		{
+			name:   "fits unchanged",
+			input:  `{"a":1}`,
+			budget: 10,
+			want:   "a: 1",
+		},
+		{
+			name:   "rows trimmed with a marker",
+			input:  users,
+			budget: 40,
+			want:   "users[3]{id,name}:\n  1,user1\n  2,user2\n  3,user3\n  # 37 more rows omitted",
+			items:  3,
+		},
+		{
+			name:   "long string cut",
+			input:  bio,
+			budget: 20,
+			want:   "id: 1\nbio: word word word wor… (+282 chars)",
+			items:  1,
+		},
+		{
+			name:    "budget too small",
+			input:   bio,
+			budget:  3,
+			wantErr: "cannot fit the result in 3 tokens (at least 16 are needed)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := toon.DecodeJSON([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, items, err := fitTokens(v, tt.budget, tokenizer.Heuristic{}, nil)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("fitTokens() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fitTokens() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("fitTokens() = %q, want %q", got, tt.want)
+			}
+			if items != tt.items {
+				t.Errorf("fitTokens() kept %d items per array, want %d", items, tt.items)
+			}
+			if n := (tokenizer.Heuristic{}).Count(got); n > tt.budget {
+				t.Errorf("fitTokens() output has %d tokens, want at most %d", n, tt.budget)
+			}
+		})
+	}
+}
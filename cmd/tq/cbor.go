@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// CBOR major types.
+const (
+	cborUint   = 0
+	cborNegint = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// cborIndefinite is the additional-information value for indefinite-length
+// items; with major type 7 it is the "break" stop code.
+const cborIndefinite = 31
+
+// cborValues converts a sequence of CBOR data items to JSON. Tags and byte
+// strings use the representation described at binaryValues.
+func cborValues(data []byte) (string, error) {
+	return binaryValues(data, func(r *binaryReader) (interface{}, error) {
+		return readCBOR(r, 0)
+	})
+}
+
+// errCBORBreak is returned when a break stop code ends an indefinite-length
+// item.
+var errCBORBreak = fmt.Errorf("break")
+
+// readCBORHead reads the initial byte of a data item and its argument.
+func readCBORHead(r *binaryReader) (major byte, info byte, arg uint64, err error) {
+	b, err := r.uint(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = byte(b)>>5, byte(b)&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		arg, err = r.uint(1 << (info - 24))
+	case info == cborIndefinite:
+		if major == cborUint || major == cborNegint || major == cborTag {
+			err = fmt.Errorf("offset %d: indefinite length not allowed for major type %d", r.pos-1, major)
+		}
+	default:
+		err = fmt.Errorf("offset %d: reserved additional information %d", r.pos-1, info)
+	}
+	return major, info, arg, err
+}
+
+func readCBOR(r *binaryReader, depth int) (interface{}, error) {
+	if depth > maxBinaryDepth {
+		return nil, fmt.Errorf("offset %d: data nested too deeply", r.pos)
+	}
+	start := r.pos
+	major, info, arg, err := readCBORHead(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		return json.Number(strconv.FormatUint(arg, 10)), nil
+
+	case cborNegint:
+		// The value is -1 - arg, which may not fit in an int64
+		n := new(big.Int).SetUint64(arg)
+		return json.Number(n.Neg(n).Sub(n, big.NewInt(1)).String()), nil
+
+	case cborBytes, cborText:
+		data, err := readCBORString(r, major, info, arg)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborBytes {
+			return bytesValue(data), nil
+		}
+		return string(data), nil
+
+	case cborArray:
+		arr := []interface{}{}
+		for i := uint64(0); info == cborIndefinite || i < arg; i++ {
+			v, err := readCBOR(r, depth+1)
+			if err == errCBORBreak && info == cborIndefinite {
+				break
+			}
+			if err != nil {
+				return nil, cborBreakError(err, r)
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+
+	case cborMap:
+		obj := toon.NewObject()
+		for i := uint64(0); info == cborIndefinite || i < arg; i++ {
+			k, err := readCBOR(r, depth+1)
+			if err == errCBORBreak && info == cborIndefinite {
+				break
+			}
+			if err != nil {
+				return nil, cborBreakError(err, r)
+			}
+			v, err := readCBOR(r, depth+1)
+			if err != nil {
+				return nil, cborBreakError(err, r)
+			}
+			key, err := binaryKey(k)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key, v)
+		}
+		return obj, nil
+
+	case cborTag:
+		v, err := readCBOR(r, depth+1)
+		if err != nil {
+			return nil, cborBreakError(err, r)
+		}
+		tag := toon.NewObject()
+		tag.Set("$tag", json.Number(strconv.FormatUint(arg, 10)))
+		tag.Set("value", v)
+		return tag, nil
+	}
+
+	// Major type 7: simple values and floats
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23: // null, undefined
+		return nil, nil
+	case 25:
+		return floatValue(halfFloat(uint16(arg)), 32), nil
+	case 26:
+		return floatValue(float64(math.Float32frombits(uint32(arg))), 32), nil
+	case 27:
+		return floatValue(math.Float64frombits(arg), 64), nil
+	case cborIndefinite:
+		return nil, errCBORBreak
+	}
+	if info == 24 && arg < 32 {
+		return nil, fmt.Errorf("offset %d: invalid simple value %d", start, arg)
+	}
+	simple := toon.NewObject()
+	simple.Set("$simple", json.Number(strconv.FormatUint(arg, 10)))
+	return simple, nil
+}
+
+// readCBORString reads the content of a byte or text string. Indefinite
+// strings are a series of definite chunks of the same type.
+func readCBORString(r *binaryReader, major, info byte, arg uint64) ([]byte, error) {
+	if info != cborIndefinite {
+		return r.next(arg)
+	}
+	var data []byte
+	for {
+		start := r.pos
+		m, i, n, err := readCBORHead(r)
+		if err != nil {
+			return nil, err
+		}
+		if m == cborSimple && i == cborIndefinite {
+			return data, nil
+		}
+		if m != major || i == cborIndefinite {
+			return nil, fmt.Errorf("offset %d: invalid chunk in indefinite-length string", start)
+		}
+		chunk, err := r.next(n)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+}
+
+// cborBreakError reports a break stop code found where a value is needed.
+func cborBreakError(err error, r *binaryReader) error {
+	if err == errCBORBreak {
+		return fmt.Errorf("offset %d: unexpected break", r.pos-1)
+	}
+	return err
+}
+
+// halfFloat converts an IEEE 754 half-precision float.
+func halfFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// toCBOR encodes one JSON value as CBOR, using definite lengths.
+func toCBOR(jsonInput string) ([]byte, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return appendCBOR(nil, v)
+}
+
+func appendCBOR(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, cborSimple<<5|22), nil
+	case bool:
+		if v {
+			return append(b, cborSimple<<5|21), nil
+		}
+		return append(b, cborSimple<<5|20), nil
+	case json.Number:
+		return appendCBORNumber(b, v)
+	case string:
+		return append(appendCBORHead(b, cborText, uint64(len(v))), v...), nil
+	case []interface{}:
+		b = appendCBORHead(b, cborArray, uint64(len(v)))
+		for _, item := range v {
+			var err error
+			if b, err = appendCBOR(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	obj := v.(*toon.Object)
+	if data, ok, err := taggedBytes(obj); ok {
+		if err != nil {
+			return nil, err
+		}
+		return append(appendCBORHead(b, cborBytes, uint64(len(data))), data...), nil
+	}
+	if tag, value, ok, err := taggedCBOR(obj); ok {
+		if err != nil {
+			return nil, err
+		}
+		return appendCBOR(appendCBORHead(b, cborTag, tag), value)
+	}
+	if n, ok := obj.Get("$simple"); ok && obj.Len() == 1 {
+		s, err := strconv.ParseUint(fmt.Sprint(n), 10, 8)
+		if _, isNumber := n.(json.Number); !isNumber || err != nil || (s >= 24 && s < 32) {
+			return nil, fmt.Errorf("$simple must be an integer from 0 to 23 or 32 to 255")
+		}
+		if s < 24 {
+			return append(b, cborSimple<<5|byte(s)), nil
+		}
+		return append(b, cborSimple<<5|24, byte(s)), nil
+	}
+
+	b = appendCBORHead(b, cborMap, uint64(obj.Len()))
+	for _, k := range obj.Keys() {
+		val, _ := obj.Get(k)
+		b = append(appendCBORHead(b, cborText, uint64(len(k))), k...)
+		var err error
+		if b, err = appendCBOR(b, val); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendCBORHead writes an initial byte and argument in the shortest form.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major<<5|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major<<5|27), n)
+}
+
+func appendCBORNumber(b []byte, n json.Number) ([]byte, error) {
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return appendCBORHead(b, cborUint, u), nil
+	}
+	// Negative integers down to -2^64 are encoded as -1 - arg
+	if i, ok := new(big.Int).SetString(string(n), 10); ok && i.Sign() < 0 {
+		arg := new(big.Int).Sub(new(big.Int).Neg(i), big.NewInt(1))
+		if arg.IsUint64() {
+			return appendCBORHead(b, cborNegint, arg.Uint64()), nil
+		}
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return nil, fmt.Errorf("number %s is out of range", n)
+	}
+	return binary.BigEndian.AppendUint64(append(b, cborSimple<<5|27), math.Float64bits(f)), nil
+}
+
+// taggedCBOR recognizes {"$tag": <number>, "value": <value>}.
+func taggedCBOR(obj *toon.Object) (uint64, interface{}, bool, error) {
+	t, ok := obj.Get("$tag")
+	value, hasValue := obj.Get("value")
+	if !ok || !hasValue || obj.Len() != 2 {
+		return 0, nil, false, nil
+	}
+	n, err := strconv.ParseUint(fmt.Sprint(t), 10, 64)
+	if _, isNumber := t.(json.Number); !isNumber || err != nil {
+		return 0, nil, true, fmt.Errorf("$tag must be a non-negative integer")
+	}
+	return n, value, true, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestCBORValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string // hex
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "map keeps key order",
+			input: "a2617a01616102",
+			want:  "{\"z\":1,\"a\":2}\n",
+		},
+		{
+			name:  "integers",
+			input: "85" + "17" + "1818" + "20" + "3903e7" + "3bffffffffffffffff",
+			want:  "[23,24,-1,-1000,-18446744073709551616]\n",
+		},
+		{
+			name:  "floats",
+			input: "84" + "f93e00" + "fa3fc00000" + "fb3ff8000000000000" + "f97c00",
+			want:  "[1.5,1.5,1.5,null]\n",
+		},
+		{
+			name:  "simple values",
+			input: "85f4f5f6f7f0",
+			want:  "[false,true,null,null,{\"$simple\":16}]\n",
+		},
+		{
+			name:  "tags and byte strings",
+			input: "82c074323031332d30332d32315432303a30343a30305a43010203",
+			want:  "[{\"$tag\":0,\"value\":\"2013-03-21T20:04:00Z\"},{\"$bytes\":\"AQID\"}]\n",
+		},
+		{
+			name:  "indefinite lengths",
+			input: "bf61619f0102ff61627f626865626c6cff5f4101ff41ffff",
+			want:  "{\"a\":[1,2],\"b\":\"hell\",\"{\\\"$bytes\\\":\\\"AQ==\\\"}\":{\"$bytes\":\"/w==\"}}\n",
+		},
+		{
+			name:  "concatenated items",
+			input: "0161780a",
+			want:  "1\n\"x\"\n10\n",
+		},
+		{
+			name:    "truncated data",
+			input:   "830102",
+			wantErr: true,
+		},
+		{
+			name:    "unexpected break",
+			input:   "82ff01",
+			wantErr: true,
+		},
+		{
+			name:    "reserved additional information",
+			input:   "1c",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.input)
+			got, err := cborValues(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cborValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("cborValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToCBOR(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string // hex
+		wantErr bool
+	}{
+		{
+			name:  "integers use the shortest form",
+			input: `[0,23,24,256,-1,-25,18446744073709551615,-18446744073709551616]`,
+			want:  "88" + "00" + "17" + "1818" + "190100" + "20" + "3818" + "1bffffffffffffffff" + "3bffffffffffffffff",
+		},
+		{
+			name:  "object, strings and literals",
+			input: `{"f":1.5,"s":"ü","n":null,"t":true}`,
+			want:  "a46166fb3ff8000000000000617362c3bc616ef66174f5",
+		},
+		{
+			name:  "tagged values",
+			input: `[{"$bytes":"AQID"},{"$tag":1,"value":1363896240},{"$simple":16},{"$simple":255}]`,
+			want:  "8443010203c11a514b67b0f0f8ff",
+		},
+		{
+			name:  "objects that only look tagged stay maps",
+			input: `{"$bytes":"AQ==","x":1}`,
+			want:  "a2662462797465736441513d3d617801",
+		},
+		{
+			name:    "reserved simple value",
+			input:   `{"$simple":24}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative tag",
+			input:   `{"$tag":-1,"value":0}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toCBOR(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toCBOR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && hex.EncodeToString(got) != tt.want {
+				t.Errorf("toCBOR() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// chunker splits results into self-contained TOON documents of at most
+// budget tokens for `tq chunk`, and writes one NDJSON record per chunk.
+type chunker struct {
+	w      io.Writer
+	budget int
+	tok    tokenizer.Tokenizer
+	source string    // input file named in each record
+	dir    string    // write chunks to numbered files here instead of inline
+	warn   io.Writer // if set, notes rows too large for the budget
+	count  int
+}
+
+// chunkTable is a tabular array too large for one chunk.
+type chunkTable struct {
+	keys []string // field names from the root to the array
+	rows []interface{}
+}
+
+// write chunks one result. Tabular arrays reached through objects that
+// do not fit in the budget on their own are split into runs of rows; each
+// run is wrapped in its parent keys and written as its own document with
+// its own [N]. Everything else stays together in a first chunk.
+func (c *chunker) write(jsonInput string) error {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	var tables []chunkTable
+	rest, err := c.split(v, nil, &tables)
+	if err != nil {
+		return err
+	}
+	if obj, ok := rest.(*toon.Object); len(tables) == 0 || ok && obj.Len() > 0 {
+		s, err := toon.Encode(rest, nil)
+		if err != nil {
+			return err
+		}
+		if err := c.emit(s, ".", -1, -1); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range tables {
+		path := chunkPath(t.keys)
+		for start := 0; start < len(t.rows); {
+			encode := func(n int) (string, error) {
+				return toon.Encode(wrap(t.keys, t.rows[start:start+n]), nil)
+			}
+			n := largest(1, min(len(t.rows)-start, c.budget), func(n int) bool {
+				s, err := encode(n)
+				return err == nil && c.tok.Count(s) <= c.budget
+			})
+			oversized := n == 0
+			if oversized {
+				// A row that does not fit on its own still gets a chunk
+				n = 1
+			}
+			text, err := encode(n)
+			if err != nil {
+				return err
+			}
+			if oversized && c.warn != nil {
+				row := fmt.Sprintf("%s[%d]", path, start)
+				if path == "." {
+					row = fmt.Sprintf(".[%d]", start)
+				}
+				fmt.Fprintf(c.warn, "Warning: row %s is %d tokens on its own, over the budget of %d\n", row, c.tok.Count(text), c.budget)
+			}
+			if err := c.emit(text, path, start, start+n); err != nil {
+				return err
+			}
+			start += n
+		}
+	}
+	return nil
+}
+
+// split returns v without the tabular arrays that need chunks of their
+// own, which it appends to tables. A root array that needs splitting
+// leaves nil behind.
+func (c *chunker) split(v interface{}, keys []string, tables *[]chunkTable) (interface{}, error) {
+	switch v := v.(type) {
+	case *toon.Object:
+		rest := toon.NewObject()
+		for _, k := range v.Keys() {
+			val, _ := v.Get(k)
+			fieldKeys := append(keys[:len(keys):len(keys)], k)
+			r, err := c.split(val, fieldKeys, tables)
+			if err != nil {
+				return nil, err
+			}
+			// Drop split arrays and objects that held nothing else
+			if _, isArray := val.([]interface{}); isArray && r == nil {
+				continue
+			}
+			if obj, ok := r.(*toon.Object); ok && obj.Len() == 0 && val.(*toon.Object).Len() > 0 {
+				continue
+			}
+			rest.Set(k, r)
+		}
+		return rest, nil
+	case []interface{}:
+		if toon.TabularFields(v) == nil {
+			return v, nil
+		}
+		s, err := toon.Encode(wrap(keys, v), nil)
+		if err != nil {
+			return nil, err
+		}
+		if c.tok.Count(s) <= c.budget {
+			return v, nil
+		}
+		*tables = append(*tables, chunkTable{keys: keys, rows: v})
+		return nil, nil
+	}
+	return v, nil
+}
+
+// emit writes the record for one chunk. start and end give the rows of a
+// split array, as in the jq slice .path[start:end], or -1 for the rest of
+// the document.
+func (c *chunker) emit(text, path string, start, end int) error {
+	c.count++
+	rec := toon.NewObject()
+	rec.Set("chunk", jsonInt(c.count))
+	rec.Set("source", c.source)
+	rec.Set("path", path)
+	if start >= 0 {
+		rec.Set("start", jsonInt(start))
+		rec.Set("end", jsonInt(end))
+	}
+	rec.Set("tokens", jsonInt(c.tok.Count(text)))
+	if c.dir != "" {
+		if c.count == 1 {
+			if err := os.MkdirAll(c.dir, 0o755); err != nil {
+				return err
+			}
+		}
+		name := filepath.Join(c.dir, fmt.Sprintf("chunk-%04d.toon", c.count))
+		if err := os.WriteFile(name, []byte(text+"\n"), 0o644); err != nil {
+			return err
+		}
+		rec.Set("file", name)
+	} else {
+		rec.Set("toon", text)
+	}
+	line, err := compactJSON(rec)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.w, line)
+	return err
+}
+
+// wrap nests v in objects with the given keys, outermost first.
+func wrap(keys []string, v interface{}) interface{} {
+	for i := len(keys) - 1; i >= 0; i-- {
+		obj := toon.NewObject()
+		obj.Set(keys[i], v)
+		v = obj
+	}
+	return v
+}
+
+// chunkPath writes keys as a jq path such as .data.users or .["a b"].
+func chunkPath(keys []string) string {
+	path := "."
+	for _, k := range keys {
+		path = toon.FieldPath(path, k)
+	}
+	return path
+}
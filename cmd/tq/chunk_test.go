@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+)
+
+func TestChunker(t *testing.T) {
+	var rows []string
+	for i := 1; i <= 12; i++ {
+		rows = append(rows, fmt.Sprintf(`{"id":%d,"name":"user%d"}`, i, i))
+	}
+	users := `[` + strings.Join(rows, ",") + `]`
+
+	tests := []struct {
+		name     string
+		input    string
+		budget   int
+		want     []string
+		warnings string
+	}{
+		{
+			name:   "small document in one chunk",
+			input:  `{"a":1,"rows":[{"x":1},{"x":2}]}`,
+			budget: 100,
+			want:   []string{`{"chunk":1,"source":"data.json","path":".","tokens":18,"toon":"a: 1\nrows[2]{x}:\n  1\n  2"}`},
+		},
+		{
+			name:   "nested tabular array split with its parent keys",
+			input:  `{"meta":{"v":1},"data":{"users":` + users + `}}`,
+			budget: 40,
+			want: []string{
+				`{"chunk":1,"source":"data.json","path":".","tokens":7,"toon":"meta:\n  v: 1"}`,
+				`{"chunk":2,"source":"data.json","path":".data.users","start":0,"end":4,"tokens":39,"toon":"data:\n  users[4]{id,name}:\n    1,user1\n    2,user2\n    3,user3\n    4,user4"}`,
+				`{"chunk":3,"source":"data.json","path":".data.users","start":4,"end":8,"tokens":39,"toon":"data:\n  users[4]{id,name}:\n    5,user5\n    6,user6\n    7,user7\n    8,user8"}`,
+				`{"chunk":4,"source":"data.json","path":".data.users","start":8,"end":12,"tokens":39,"toon":"data:\n  users[4]{id,name}:\n    9,user9\n    10,user10\n    11,user11\n    12,user12"}`,
+			},
+		},
+		{
+			name:   "root array and an oversized row",
+			input:  `[{"text":"` + strings.Repeat("word ", 20) + `"},{"text":"short"}]`,
+			budget: 10,
+			want: []string{
+				`{"chunk":1,"source":"data.json","path":".","start":0,"end":1,"tokens":47,"toon":"[1]{text}:\n  \"` + strings.Repeat("word ", 20) + `\""}`,
+				`{"chunk":2,"source":"data.json","path":".","start":1,"end":2,"tokens":8,"toon":"[1]{text}:\n  short"}`,
+			},
+			warnings: "Warning: row .[0] is 47 tokens on its own, over the budget of 10\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, warn strings.Builder
+			c := &chunker{w: &out, budget: tt.budget, tok: tokenizer.Heuristic{}, source: "data.json", warn: &warn}
+			if err := c.write(tt.input); err != nil {
+				t.Fatalf("write() error = %v", err)
+			}
+			got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("chunks =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if warn.String() != tt.warnings {
+				t.Errorf("warnings = %q, want %q", warn.String(), tt.warnings)
+			}
+		})
+	}
+}
+
+func TestChunkerFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "chunks")
+	var out strings.Builder
+	c := &chunker{w: &out, budget: 10, tok: tokenizer.Heuristic{}, source: "-", dir: dir}
+	if err := c.write(`{"rows":[{"id":1},{"id":2},{"id":3},{"id":4}]}`); err != nil {
+		t.Fatal(err)
+	}
+
+	first := filepath.Join(dir, "chunk-0001.toon")
+	want := fmt.Sprintf(`{"chunk":1,"source":"-","path":".rows","start":0,"end":1,"tokens":9,"file":%q}`, first)
+	if line := strings.SplitN(out.String(), "\n", 2)[0]; line != want {
+		t.Errorf("first record = %s, want %s", line, want)
+	}
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "rows[1]{id}:\n  1\n" {
+		t.Errorf("chunk-0001.toon = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "chunk-0004.toon")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChunkPath(t *testing.T) {
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{nil, "."},
+		{[]string{"data", "users"}, ".data.users"},
+		{[]string{"a b", "c"}, `.["a b"].c`},
+		{[]string{"x", "1st"}, `.x["1st"]`},
+	}
+	for _, tt := range tests {
+		if got := chunkPath(tt.keys); got != tt.want {
+			t.Errorf("chunkPath(%q) = %s, want %s", tt.keys, got, tt.want)
+		}
+	}
+}
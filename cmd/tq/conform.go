@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// conformer checks each result against a template for `tq conform` and
+// writes one line per mismatch.
+type conformer struct {
+	w          io.Writer
+	template   interface{}
+	mismatches int
+}
+
+func (c *conformer) write(jsonInput string) error {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	for _, m := range toon.Conform(c.template, v) {
+		c.mismatches++
+		if _, err := fmt.Fprintln(c.w, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTemplate reads a template for `tq conform`. TOON templates may use
+// the placeholders described at toon.ParseTemplate; templates in other
+// formats are read as example documents.
+func loadTemplate(name string, opts *options) (interface{}, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	format := detectInputFormat(name, data)
+	if format == "toon" {
+		return toon.ParseTemplate(data)
+	}
+	jsonData, err := decodeInput(format, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return toon.DecodeJSON([]byte(jsonData))
+}
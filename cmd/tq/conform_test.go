@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConformer(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		file     string
+		template string
+		results  []string
+		want     string
+	}{
+		{
+			name:     "toon template",
+			file:     "expected.toon",
+			template: "query: string\nresults[N]{id,score}:",
+			results:  []string{`{"query":"q","results":[{"id":1,"score":2}]}`, `{"query":1,"results":[{"id":1}]}`},
+			want:     ".query: expected string, got number\n.results[0].score: missing key\n",
+		},
+		{
+			name:     "json template as an example",
+			file:     "expected.json",
+			template: `{"id": 1, "tags": ["a"]}`,
+			results:  []string{`{"id":2,"tags":["b",3]}`},
+			want:     ".tags[1]: expected string, got number\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(name, []byte(tt.template), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			template, err := loadTemplate(name, &options{})
+			if err != nil {
+				t.Fatalf("loadTemplate() error = %v", err)
+			}
+			var out strings.Builder
+			c := &conformer{w: &out, template: template}
+			for _, r := range tt.results {
+				if err := c.write(r); err != nil {
+					t.Fatalf("write() error = %v", err)
+				}
+			}
+			if out.String() != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+			if want := strings.Count(tt.want, "\n"); c.mismatches != want {
+				t.Errorf("mismatches = %d, want %d", c.mismatches, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// csvQuoteModes lists the values accepted by --quote.
+var csvQuoteModes = []string{"auto", "all", "none"}
+
+// csvOptions controls how CSV and TSV are read and written.
+type csvOptions struct {
+	noHeader  bool   // the first row is data, not column names
+	delimiter rune   // 0 selects ',' for CSV and tab for TSV
+	quote     string // auto (RFC 4180), all, or none
+	noInfer   bool   // keep every cell as a string
+	flatten   bool   // write nested values as dotted columns
+}
+
+// delimiterFor returns the field delimiter for format.
+func (o csvOptions) delimiterFor(format string) rune {
+	if o.delimiter != 0 {
+		return o.delimiter
+	}
+	if format == "tsv" {
+		return '\t'
+	}
+	return ','
+}
+
+// quoteFor returns the quoting mode for format. TSV files conventionally
+// contain no quoting at all, so quote characters are literal there unless
+// asked otherwise.
+func (o csvOptions) quoteFor(format string) string {
+	if o.quote != "" {
+		return o.quote
+	}
+	if format == "tsv" {
+		return "none"
+	}
+	return "auto"
+}
+
+// parseDelimiter accepts a single character or the escape "\t".
+func parseDelimiter(s string) (rune, error) {
+	if s == `\t` || s == "tab" {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == '"' || r == '\n' || r == '\r' {
+		return 0, fmt.Errorf("invalid delimiter %q (expected a single character)", s)
+	}
+	return r, nil
+}
+
+// csvValues converts CSV or TSV input to a single JSON array. With a header
+// row each record becomes an object, which encodes as a TOON tabular
+// array; without one each record becomes an array of cells.
+func csvValues(data []byte, format string, opts csvOptions) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	records, err := readRecords(data, opts.delimiterFor(format), opts.quoteFor(format))
+	if err != nil {
+		return "", err
+	}
+
+	rows := []interface{}{}
+	if opts.noHeader {
+		for _, rec := range records {
+			row := make([]interface{}, len(rec))
+			for i, cell := range rec {
+				row[i] = inferCell(cell, opts.noInfer)
+			}
+			rows = append(rows, row)
+		}
+	} else if len(records) > 0 {
+		header := records[0]
+		seen := make(map[string]bool)
+		for i, name := range header {
+			if name == "" {
+				header[i] = fmt.Sprintf("column%d", i+1)
+			}
+			if seen[header[i]] {
+				return "", fmt.Errorf("duplicate column name %q in header", header[i])
+			}
+			seen[header[i]] = true
+		}
+		for _, rec := range records[1:] {
+			row := toon.NewObject()
+			for i, name := range header {
+				row.Set(name, inferCell(rec[i], opts.noInfer))
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	b, err := json.Marshal(rows)
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// readRecords splits data into records. Every record must have as many
+// fields as the first one.
+func readRecords(data []byte, delim rune, quote string) ([][]string, error) {
+	if quote != "none" {
+		r := csv.NewReader(bytes.NewReader(data))
+		r.Comma = delim
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+
+	var records [][]string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		rec := strings.Split(line, string(delim))
+		if len(records) > 0 && len(rec) != len(records[0]) {
+			return nil, fmt.Errorf("record on line %d: wrong number of fields", i+1)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// inferCell converts numeric and boolean cells to JSON numbers and
+// booleans. Cells with leading zeros, such as zip codes, stay strings.
+func inferCell(cell string, noInfer bool) interface{} {
+	if noInfer {
+		return cell
+	}
+	if jsonNumber.MatchString(cell) {
+		return json.Number(cell)
+	}
+	switch strings.ToLower(cell) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return cell
+}
+
+// csvWriter writes filter results as CSV or TSV rows. A result that is an
+// array contributes one row per element; a result that is an object
+// contributes a single row. The header comes from the first result, in
+// the same field order as a TOON tabular header.
+type csvWriter struct {
+	w      io.Writer
+	format string
+	opts   csvOptions
+	header []string
+	rows   int
+}
+
+func (cw *csvWriter) write(jsonLine string) error {
+	v, err := toon.DecodeJSON([]byte(jsonLine))
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	var items []interface{}
+	switch v := v.(type) {
+	case []interface{}:
+		items = v
+	case *toon.Object:
+		items = []interface{}{v}
+	default:
+		return fmt.Errorf("%s output needs an array of objects, got %s", cw.format, jsonType(v))
+	}
+
+	rows := make([]*toon.Object, len(items))
+	for i, item := range items {
+		obj, ok := item.(*toon.Object)
+		if !ok {
+			return fmt.Errorf("row %d: %s output needs objects, got %s", cw.rows+i+1, cw.format, jsonType(item))
+		}
+		if cw.opts.flatten {
+			flat := toon.NewObject()
+			flattenInto(flat, "", ".", obj)
+			obj = flat
+		}
+		rows[i] = obj
+	}
+
+	writeHeader := cw.header == nil
+	if writeHeader {
+		seen := make(map[string]bool)
+		cw.header = []string{}
+		for _, row := range rows {
+			for _, k := range row.Keys() {
+				if !seen[k] {
+					seen[k] = true
+					cw.header = append(cw.header, k)
+				}
+			}
+		}
+	}
+
+	// Build every record before writing, so a bad row leaves no partial output
+	records := make([][]string, len(rows))
+	for n, row := range rows {
+		for _, k := range row.Keys() {
+			if !contains(cw.header, k) {
+				return fmt.Errorf("row %d: field %q is not in the header", cw.rows+n+1, k)
+			}
+		}
+		rec := make([]string, len(cw.header))
+		for i, k := range cw.header {
+			val, _ := row.Get(k)
+			cell, err := csvCell(val)
+			if err != nil {
+				return fmt.Errorf("row %d, column %q: %v", cw.rows+n+1, k, err)
+			}
+			rec[i] = cell
+		}
+		records[n] = rec
+	}
+
+	if writeHeader && !cw.opts.noHeader {
+		if err := cw.writeRecord(cw.header); err != nil {
+			return fmt.Errorf("header: %v", err)
+		}
+	}
+	for _, rec := range records {
+		cw.rows++
+		if err := cw.writeRecord(rec); err != nil {
+			return fmt.Errorf("row %d: %v", cw.rows, err)
+		}
+	}
+	return nil
+}
+
+// writeRecord writes one line, quoting fields as the quote mode requires.
+func (cw *csvWriter) writeRecord(rec []string) error {
+	delim := string(cw.opts.delimiterFor(cw.format))
+	quote := cw.opts.quoteFor(cw.format)
+	fields := make([]string, len(rec))
+	for i, f := range rec {
+		special := strings.Contains(f, delim) || strings.ContainsAny(f, "\"\r\n")
+		switch {
+		case quote == "all" || (quote == "auto" && special):
+			fields[i] = `"` + strings.ReplaceAll(f, `"`, `""`) + `"`
+		case quote == "none" && (strings.Contains(f, delim) || strings.ContainsAny(f, "\r\n")):
+			return fmt.Errorf("value %q cannot be written without quoting", f)
+		default:
+			fields[i] = f
+		}
+	}
+	_, err := fmt.Fprintln(cw.w, strings.Join(fields, delim))
+	return err
+}
+
+// csvCell renders a scalar as a cell. Nested values are rejected; use
+// --flatten to spread them over several columns.
+func csvCell(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("nested %s cannot be written as a cell (use --flatten)", jsonType(v))
+}
+
+// flattenInto copies v into dst, naming nested fields by their path
+// joined with sep: with ".", {"a":{"b":1},"t":[x,y]} becomes a.b, t.0
+// and t.1. Empty containers are kept as their JSON text.
+func flattenInto(dst *toon.Object, prefix, sep string, v interface{}) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + sep + k
+	}
+	switch v := v.(type) {
+	case *toon.Object:
+		if v.Len() == 0 && prefix != "" {
+			dst.Set(prefix, "{}")
+			return
+		}
+		for _, k := range v.Keys() {
+			val, _ := v.Get(k)
+			flattenInto(dst, join(k), sep, val)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			dst.Set(prefix, "[]")
+			return
+		}
+		for i, item := range v {
+			flattenInto(dst, join(strconv.Itoa(i)), sep, item)
+		}
+	default:
+		dst.Set(prefix, v)
+	}
+}
+
+// jsonType names the JSON type of a decoded value, as jq's type does.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
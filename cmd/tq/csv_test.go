@@ -0,0 +1,202 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCSVValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		opts    csvOptions
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "header row and type inference",
+			format: "csv",
+			input:  "id,name,zip,active,score\n1,\"Smith, A\",01234,TRUE,9.5\n",
+			want:   `[{"id":1,"name":"Smith, A","zip":"01234","active":true,"score":9.5}]`,
+		},
+		{
+			name:   "type inference disabled",
+			format: "csv",
+			opts:   csvOptions{noInfer: true},
+			input:  "id,active\n1,true\n",
+			want:   `[{"id":"1","active":"true"}]`,
+		},
+		{
+			name:   "no header row",
+			format: "csv",
+			opts:   csvOptions{noHeader: true},
+			input:  "1,a\n2,b\n",
+			want:   `[[1,"a"],[2,"b"]]`,
+		},
+		{
+			name:   "custom delimiter",
+			format: "csv",
+			opts:   csvOptions{delimiter: ';'},
+			input:  "a;b\n1;x,y\n",
+			want:   `[{"a":1,"b":"x,y"}]`,
+		},
+		{
+			name:   "TSV keeps quotes literally",
+			format: "tsv",
+			input:  "a\tb\n\"x\t1\n",
+			want:   `[{"a":"\"x","b":1}]`,
+		},
+		{
+			name:   "TSV with quoting enabled",
+			format: "tsv",
+			opts:   csvOptions{quote: "auto"},
+			input:  "a\tb\n\"x\ty\"\t1\n",
+			want:   `[{"a":"x\ty","b":1}]`,
+		},
+		{
+			name:   "byte order mark is ignored",
+			format: "csv",
+			input:  "\xef\xbb\xbfid\n7\n",
+			want:   `[{"id":7}]`,
+		},
+		{
+			name:   "empty input",
+			format: "csv",
+			input:  "",
+			want:   `[]`,
+		},
+		{
+			name:    "ragged rows",
+			format:  "csv",
+			input:   "a,b\n1\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate column",
+			format:  "csv",
+			input:   "a,a\n1,2\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := csvValues([]byte(tt.input), tt.format, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("csvValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && strings.TrimSpace(got) != tt.want {
+				t.Errorf("csvValues() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		opts    csvOptions
+		results []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "array of flat objects",
+			format:  "csv",
+			results: []string{`[{"id":1,"name":"Smith, A","ok":true},{"id":2,"name":"Bob","ok":null}]`},
+			want:    "id,name,ok\n1,\"Smith, A\",true\n2,Bob,\n",
+		},
+		{
+			name:    "one object per result shares the header",
+			format:  "csv",
+			results: []string{`{"a":1,"b":2}`, `{"a":3}`},
+			want:    "a,b\n1,2\n3,\n",
+		},
+		{
+			name:    "TSV",
+			format:  "tsv",
+			results: []string{`[{"a":"x y","b":"q\"r"}]`},
+			want:    "a\tb\nx y\tq\"r\n",
+		},
+		{
+			name:    "quote all without header",
+			format:  "csv",
+			opts:    csvOptions{quote: "all", noHeader: true},
+			results: []string{`[{"a":1,"b":"x"}]`},
+			want:    "\"1\",\"x\"\n",
+		},
+		{
+			name:    "flatten nested values",
+			format:  "csv",
+			opts:    csvOptions{flatten: true},
+			results: []string{`[{"a":1,"b":{"c":2},"t":["x","y"],"e":[]}]`},
+			want:    "a,b.c,t.0,t.1,e\n1,2,x,y,[]\n",
+		},
+		{
+			name:    "nested value without flatten",
+			format:  "csv",
+			results: []string{`[{"a":1,"b":{"c":2}}]`},
+			wantErr: true,
+		},
+		{
+			name:    "field missing from header",
+			format:  "csv",
+			results: []string{`{"a":1}`, `{"a":2,"b":3}`},
+			wantErr: true,
+		},
+		{
+			name:    "scalar result",
+			format:  "csv",
+			results: []string{`42`},
+			wantErr: true,
+		},
+		{
+			name:    "unquotable value",
+			format:  "tsv",
+			results: []string{`[{"a":"x\ty"}]`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			cw := &csvWriter{w: &out, format: tt.format, opts: tt.opts}
+			var err error
+			for _, r := range tt.results {
+				if err = cw.write(r); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && out.String() != tt.want {
+				t.Errorf("write() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    rune
+		wantErr bool
+	}{
+		{in: ";", want: ';'},
+		{in: `\t`, want: '\t'},
+		{in: "|", want: '|'},
+		{in: "", wantErr: true},
+		{in: "ab", wantErr: true},
+		{in: `"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDelimiter(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDelimiter(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// extractModes lists the values accepted by --extract.
+var extractModes = []string{"fenced"}
+
+// fenceFormats maps the language of a Markdown code fence to the input
+// format its content is decoded with.
+var fenceFormats = map[string]string{
+	"toon":       "toon",
+	"json":       "json",
+	"jsonc":      "json5",
+	"json5":      "json5",
+	"jsonl":      "ndjson",
+	"ndjson":     "ndjson",
+	"yaml":       "yaml",
+	"yml":        "yaml",
+	"toml":       "toml",
+	"xml":        "xml",
+	"csv":        "csv",
+	"tsv":        "tsv",
+	"ini":        "ini",
+	"properties": "properties",
+	"dotenv":     "dotenv",
+	"env":        "dotenv",
+	"logfmt":     "logfmt",
+}
+
+// fenceLangs returns the languages --fence-lang accepts, sorted.
+func fenceLangs() []string {
+	langs := make([]string, 0, len(fenceFormats))
+	for lang := range fenceFormats {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// codeBlock is a fenced code block extracted from Markdown.
+type codeBlock struct {
+	index     int    // position among the extracted blocks, from 0
+	lang      string // language from the info string, in lower case
+	startLine int    // first and last content line, from 1
+	endLine   int
+	text      string
+}
+
+// meta describes the block to the filter as $fence.
+func (b codeBlock) meta() (string, error) {
+	m := toon.NewObject()
+	m.Set("index", jsonInt(b.index))
+	m.Set("lang", b.lang)
+	m.Set("start_line", jsonInt(b.startLine))
+	m.Set("end_line", jsonInt(b.endLine))
+	return compactJSON(m)
+}
+
+// extractCodeBlocks returns the fenced code blocks of a Markdown document
+// whose language is one of langs, following CommonMark: a fence is three
+// or more backticks or tildes, it is closed by a fence of the same
+// character that is at least as long, and an unclosed fence runs to the
+// end of the document, as in a truncated model reply. Fences may be
+// indented any amount, as inside list items; the opening fence's
+// indentation is removed from the content.
+func extractCodeBlocks(data []byte, langs []string) []codeBlock {
+	wanted := make(map[string]bool)
+	for _, lang := range langs {
+		wanted[lang] = true
+	}
+
+	var blocks []codeBlock
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i := 0; i < len(lines); i++ {
+		indent, marker, info, ok := openingFence(lines[i])
+		if !ok {
+			continue
+		}
+		lang := ""
+		if words := strings.Fields(info); len(words) > 0 {
+			lang = strings.ToLower(words[0])
+		}
+		end := len(lines)
+		for j := i + 1; j < len(lines); j++ {
+			if closingFence(lines[j], marker) {
+				end = j
+				break
+			}
+		}
+		if wanted[lang] {
+			var text strings.Builder
+			for _, line := range lines[i+1 : end] {
+				text.WriteString(strings.Replace(trimIndent(line, indent), "\r\n", "\n", 1))
+			}
+			blocks = append(blocks, codeBlock{
+				index:     len(blocks),
+				lang:      lang,
+				startLine: i + 2,
+				endLine:   end,
+				text:      text.String(),
+			})
+		}
+		i = end
+	}
+	return blocks
+}
+
+// openingFence parses a line that opens a code block and returns its
+// indentation, its run of backticks or tildes, and the info string.
+func openingFence(line string) (indent int, marker, info string, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	for indent < len(line) && line[indent] == ' ' {
+		indent++
+	}
+	rest := line[indent:]
+	if rest == "" || rest[0] != '`' && rest[0] != '~' {
+		return 0, "", "", false
+	}
+	n := len(rest) - len(strings.TrimLeft(rest, rest[:1]))
+	if n < 3 {
+		return 0, "", "", false
+	}
+	info = strings.TrimSpace(rest[n:])
+	if rest[0] == '`' && strings.Contains(info, "`") {
+		return 0, "", "", false
+	}
+	return indent, rest[:n], info, true
+}
+
+// closingFence reports whether line closes a block opened with marker.
+func closingFence(line, marker string) bool {
+	line = strings.Trim(line, " \t\r\n")
+	return len(line) >= len(marker) && strings.Trim(line, marker[:1]) == ""
+}
+
+// trimIndent removes up to n leading spaces from line.
+func trimIndent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return line[i:]
+}
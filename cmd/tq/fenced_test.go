@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractCodeBlocks(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		langs []string
+		want  []codeBlock
+	}{
+		{
+			name:  "toon blocks between prose",
+			input: "Here you go:\n\n```toon\na: 1\n```\n\nand\n\n```TOON extra\nb: 2\nc: 3\n```\n",
+			langs: []string{"toon"},
+			want: []codeBlock{
+				{index: 0, lang: "toon", startLine: 4, endLine: 4, text: "a: 1\n"},
+				{index: 1, lang: "toon", startLine: 10, endLine: 11, text: "b: 2\nc: 3\n"},
+			},
+		},
+		{
+			name:  "other languages are skipped with their content",
+			input: "```markdown\n```toon\nnot: this\n```\n```json\n{}\n```\n",
+			langs: []string{"toon", "json"},
+			want: []codeBlock{
+				{index: 0, lang: "json", startLine: 6, endLine: 6, text: "{}\n"},
+			},
+		},
+		{
+			name:  "tildes, longer fences and indented list items",
+			input: "1. Result:\n   ~~~~yaml\n   a:\n     - 1\n   ~~~\n   ~~~~\n",
+			langs: []string{"yaml"},
+			want: []codeBlock{
+				{index: 0, lang: "yaml", startLine: 3, endLine: 5, text: "a:\n  - 1\n~~~\n"},
+			},
+		},
+		{
+			name:  "unclosed fence runs to the end",
+			input: "```toon\r\na: 1\r\nb: 2",
+			langs: []string{"toon"},
+			want: []codeBlock{
+				{index: 0, lang: "toon", startLine: 2, endLine: 3, text: "a: 1\nb: 2"},
+			},
+		},
+		{
+			name:  "no fences",
+			input: "Just ``inline`` code and `` ``` `` text",
+			langs: []string{"toon"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractCodeBlocks([]byte(tt.input), tt.langs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractCodeBlocks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeBlockMeta(t *testing.T) {
+	b := codeBlock{index: 2, lang: "json", startLine: 10, endLine: 14}
+	got, err := b.meta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"index":2,"lang":"json","start_line":10,"end_line":14}`; got != want {
+		t.Errorf("meta() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// editInPlace replaces the contents of path with the TOON encoding of the
+// single JSON result in result. Filters that produce no output or several
+// outputs are rejected, since there would be nothing sensible to write.
+func editInPlace(path, result, backupSuffix string) error {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(result), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 1 {
+		return fmt.Errorf("filter produced %d results; --in-place needs exactly one", len(lines))
+	}
+
+	toonOutput, err := jsonToTOON(lines[0])
+	if err != nil {
+		return fmt.Errorf("converting to TOON: %v", err)
+	}
+	return writeFileAtomic(path, []byte(toonOutput), backupSuffix)
+}
+
+// writeFileAtomic replaces path with data. The data is written to a
+// temporary file in the same directory and renamed over the original, so
+// readers see either the old or the new contents, never a partial file.
+// The original permissions are kept. When backupSuffix is not empty, the
+// original is first copied to path+backupSuffix.
+func writeFileAtomic(path string, data []byte, backupSuffix string) error {
+	// Write through symlinks instead of replacing them
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if backupSuffix != "" {
+		if err := copyFile(path, path+backupSuffix, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("creating backup: %v", err)
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// copyFile copies src to dst, creating or truncating dst with perm.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
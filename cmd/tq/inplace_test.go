@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tests := []struct {
+		name         string
+		backupSuffix string
+	}{
+		{name: "without backup"},
+		{name: "with backup", backupSuffix: ".bak"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.toon")
+			if err := os.WriteFile(path, []byte("version: 1.1\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeFileAtomic(path, []byte("version: 1.2\n"), tt.backupSuffix); err != nil {
+				t.Fatalf("writeFileAtomic() error = %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "version: 1.2\n" {
+				t.Errorf("file contents = %q, want %q", got, "version: 1.2\n")
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("file mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+			}
+
+			backup, err := os.ReadFile(path + ".bak")
+			if tt.backupSuffix == "" {
+				if err == nil {
+					t.Error("backup created without --backup")
+				}
+			} else if string(backup) != "version: 1.1\n" {
+				t.Errorf("backup contents = %q, want %q", backup, "version: 1.1\n")
+			}
+
+			// No temporary files may be left behind
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if strings.Contains(e.Name(), ".tmp-") {
+					t.Errorf("temporary file %s left behind", e.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.toon")
+	link := filepath.Join(dir, "link.toon")
+	if err := os.WriteFile(target, []byte("a: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported")
+	}
+
+	if err := writeFileAtomic(link, []byte("a: 2\n"), ""); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink was replaced by a regular file")
+	}
+	if got, _ := os.ReadFile(target); string(got) != "a: 2\n" {
+		t.Errorf("target contents = %q, want %q", got, "a: 2\n")
+	}
+}
+
+func TestEditInPlaceResultCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		result string
+	}{
+		{name: "no results", result: ""},
+		{name: "multiple results", result: "{\"a\":1}\n{\"a\":2}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.toon")
+			if err := os.WriteFile(path, []byte("a: 1\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := editInPlace(path, tt.result, ".bak"); err == nil {
+				t.Fatal("editInPlace() should reject the result")
+			}
+			if got, _ := os.ReadFile(path); string(got) != "a: 1\n" {
+				t.Errorf("file was modified: %q", got)
+			}
+			if _, err := os.Stat(path + ".bak"); err == nil {
+				t.Error("backup created for a rejected edit")
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// inputFormats lists the values accepted by --input-format.
+var inputFormats = []string{"auto", "toon", "json", "ndjson", "yaml", "toml", "xml", "csv", "tsv", "msgpack", "cbor", "dotenv", "properties", "ini", "logfmt", "json5"}
+
+// jsonNumber matches number literals that are valid JSON as written.
+var jsonNumber = regexp.MustCompile(`^-?(?:0|[1-9]\d*)(?:\.\d+)?(?:[eE][+-]?\d+)?$`)
+
+// toonArrayHeader matches the start of a TOON root array such as `[3]:`,
+// `[#2|]{a|b}:` or `[0]:`, which would otherwise look like JSON.
+var toonArrayHeader = regexp.MustCompile(`^\[#?\d+[\t|]?\][{:]`)
+
+// detectInputFormat picks the input format from the file extension, or
+// from the first bytes of the input when the extension is not known.
+func detectInputFormat(filename string, head []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".toon":
+		return "toon"
+	case ".json":
+		return "json"
+	case ".json5", ".jsonc":
+		return "json5"
+	case ".jsonl", ".ndjson":
+		return "ndjson"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".xml":
+		return "xml"
+	case ".csv":
+		return "csv"
+	case ".tsv", ".tab":
+		return "tsv"
+	case ".msgpack", ".mpk":
+		return "msgpack"
+	case ".cbor":
+		return "cbor"
+	case ".env":
+		return "dotenv"
+	case ".properties":
+		return "properties"
+	case ".ini", ".cfg":
+		return "ini"
+	case ".logfmt":
+		return "logfmt"
+	}
+
+	head = bytes.TrimLeft(head, " \t\r\n")
+	switch {
+	case len(head) == 0:
+		return "toon"
+	case bytes.HasPrefix(head, []byte("---")) || bytes.HasPrefix(head, []byte("%YAML")):
+		return "yaml"
+	case head[0] == '{':
+		return "json"
+	case head[0] == '<':
+		return "xml"
+	case logfmtLine.Match(head):
+		return "logfmt"
+	case head[0] == '[' && !toonArrayHeader.Match(head):
+		return "json"
+	}
+	return "toon"
+}
+
+// decodeInput converts input in the given format to a stream of JSON
+// values, one per line, ready to be fed to jq.
+func decodeInput(format string, data []byte, opts *options) (string, error) {
+	switch format {
+	case "json":
+		return jsonValues(data)
+	case "ndjson":
+		return ndjsonValues(data)
+	case "json5":
+		return json5Values(data)
+	case "yaml":
+		return yamlValues(data)
+	case "toml":
+		return tomlValues(data)
+	case "xml":
+		return xmlValues(data, opts.csv.noInfer)
+	case "csv", "tsv":
+		return csvValues(data, format, opts.csv)
+	case "msgpack":
+		return msgpackValues(data)
+	case "cbor":
+		return cborValues(data)
+	case "dotenv":
+		return dotenvValues(data, opts)
+	case "properties":
+		return propertiesValues(data, opts)
+	case "ini":
+		return iniValues(data, opts)
+	case "logfmt":
+		return logfmtValues(data, opts.csv.noInfer)
+	default:
+		// Convert TOON to JSON using Node.js script
+		return toonToJSON(string(data))
+	}
+}
+
+// jsonValues validates a sequence of JSON values and returns them in
+// compact form, one per line. Key order and number formatting are kept.
+func jsonValues(data []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var out strings.Builder
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return out.String(), nil
+		}
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line := bytes.Count(data[:min(syntaxErr.Offset, int64(len(data)))], []byte("\n")) + 1
+			return "", fmt.Errorf("line %d: %v", line, err)
+		}
+		if err == io.ErrUnexpectedEOF {
+			return "", fmt.Errorf("unexpected end of input")
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := writeCompact(&out, raw); err != nil {
+			return "", err
+		}
+	}
+}
+
+// ndjsonValues validates newline-delimited JSON, where every non-blank
+// line holds exactly one value, and returns the records one per line.
+func ndjsonValues(data []byte) (string, error) {
+	var out strings.Builder
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !json.Valid([]byte(line)) {
+			var v interface{}
+			err := json.Unmarshal([]byte(line), &v)
+			return "", fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if err := writeCompact(&out, json.RawMessage(line)); err != nil {
+			return "", fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return out.String(), nil
+}
+
+func writeCompact(out *strings.Builder, raw json.RawMessage) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return err
+	}
+	out.Write(buf.Bytes())
+	out.WriteByte('\n')
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDetectInputFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		head     string
+		want     string
+	}{
+		{name: "toon extension", filename: "data.toon", head: `{"a":1}`, want: "toon"},
+		{name: "json extension", filename: "data.JSON", head: "a: 1", want: "json"},
+		{name: "jsonl extension", filename: "logs.jsonl", head: "", want: "ndjson"},
+		{name: "ndjson extension", filename: "logs.ndjson", head: "", want: "ndjson"},
+		{name: "toml extension", filename: "Cargo.toml", head: "[package]", want: "toml"},
+		{name: "xml extension", filename: "feed.XML", head: "", want: "xml"},
+		{name: "sniff XML", head: "<?xml version=\"1.0\"?>", want: "xml"},
+		{name: "sniff logfmt", head: "level=info msg=\"started\"", want: "logfmt"},
+		{name: "TOON value containing '='", head: "query: a=b", want: "toon"},
+		{name: "jsonc extension", filename: "settings.jsonc", head: "// editor\n{", want: "json5"},
+		{name: "json5 extension", filename: "config.json5", head: "{a: 1}", want: "json5"},
+		{name: "logfmt extension", filename: "app.logfmt", head: "", want: "logfmt"},
+		{name: "msgpack extension", filename: "msg.msgpack", head: "\x81", want: "msgpack"},
+		{name: "cbor extension", filename: "msg.cbor", head: "\xa1", want: "cbor"},
+		{name: "dotenv file", filename: ".env", head: "PORT=8080", want: "dotenv"},
+		{name: "properties extension", filename: "app.properties", head: "a.b=1", want: "properties"},
+		{name: "ini extension", filename: "setup.cfg", head: "[metadata]", want: "ini"},
+		{name: "sniff JSON object", head: "  \n{\"a\":1}", want: "json"},
+		{name: "sniff JSON array", head: `[1,2,3]`, want: "json"},
+		{name: "sniff TOON root array", head: "[3]: 1,2,3", want: "toon"},
+		{name: "sniff TOON tabular root array", head: "[2|]{a|b}:\n  1|2", want: "toon"},
+		{name: "sniff TOON object", head: "name: John", want: "toon"},
+		{name: "empty input", head: "", want: "toon"},
+		{name: "unknown extension falls back to sniffing", filename: "dump.txt", head: `{"a":1}`, want: "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectInputFormat(tt.filename, []byte(tt.head)); got != tt.want {
+				t.Errorf("detectInputFormat(%q, %q) = %q, want %q", tt.filename, tt.head, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInputJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "pretty JSON is compacted",
+			format: "json",
+			input:  "{\n  \"b\": 1,\n  \"a\": [1, 2]\n}",
+			want:   "{\"b\":1,\"a\":[1,2]}\n",
+		},
+		{
+			name:   "concatenated JSON values",
+			format: "json",
+			input:  `{"a":1} {"a":2}`,
+			want:   "{\"a\":1}\n{\"a\":2}\n",
+		},
+		{
+			name:   "numbers keep their text",
+			format: "json",
+			input:  `{"big":12345678901234567890,"f":1.50}`,
+			want:   "{\"big\":12345678901234567890,\"f\":1.50}\n",
+		},
+		{
+			name:    "invalid JSON",
+			format:  "json",
+			input:   "{\"a\":1}\n{\"b\": x}",
+			wantErr: true,
+		},
+		{
+			name:    "truncated JSON",
+			format:  "json",
+			input:   `[1,2`,
+			wantErr: true,
+		},
+		{
+			name:   "NDJSON records",
+			format: "ndjson",
+			input:  "{\"a\":1}\n\n{\"a\": 2}\n",
+			want:   "{\"a\":1}\n{\"a\":2}\n",
+		},
+		{
+			name:    "NDJSON record split across lines",
+			format:  "ndjson",
+			input:   "{\"a\":\n1}",
+			wantErr: true,
+		},
+		{
+			name:    "NDJSON with two values on a line",
+			format:  "ndjson",
+			input:   "1 2",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeInput(tt.format, []byte(tt.input), &options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("decodeInput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// maxJSON5Depth limits nesting so that hostile input cannot exhaust the
+// stack.
+const maxJSON5Depth = 1000
+
+// json5Values converts JSON5 input, which also covers JSONC, to JSON
+// values, one per line. On top of JSON it accepts // and /* */ comments,
+// trailing commas, unquoted keys, single-quoted strings, hexadecimal
+// numbers, leading or trailing decimal points and a leading '+'.
+//
+// Infinity, -Infinity and NaN cannot be represented in JSON or TOON and
+// become null. Numbers too large for a 64-bit float are kept as written,
+// as with JSON input, and jq clamps them to the largest float.
+func json5Values(data []byte) (string, error) {
+	p := &json5Parser{s: strings.TrimPrefix(string(data), "\xef\xbb\xbf")}
+	var out strings.Builder
+	for {
+		if err := p.skip(); err != nil {
+			return "", err
+		}
+		if p.pos >= len(p.s) {
+			return out.String(), nil
+		}
+		v, err := p.value(0)
+		if err != nil {
+			return "", err
+		}
+		s, err := compactJSON(v)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(s)
+		out.WriteByte('\n')
+	}
+}
+
+type json5Parser struct {
+	s   string
+	pos int
+}
+
+// errorf reports an error at the current position as line:column.
+func (p *json5Parser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.s[:p.pos], "\n") + 1
+	col := utf8.RuneCountInString(p.s[strings.LastIndexByte(p.s[:p.pos], '\n')+1:p.pos]) + 1
+	return fmt.Errorf("line %d, column %d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+// unexpected reports the character at the current position.
+func (p *json5Parser) unexpected(what string) error {
+	if p.pos >= len(p.s) {
+		return p.errorf("unexpected end of input, expected %s", what)
+	}
+	r, _ := utf8.DecodeRuneInString(p.s[p.pos:])
+	return p.errorf("unexpected %q, expected %s", r, what)
+}
+
+// skip moves past whitespace and comments.
+func (p *json5Parser) skip() error {
+	for p.pos < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		switch {
+		case r == '\ufeff' || unicode.IsSpace(r):
+			p.pos += size
+		case strings.HasPrefix(p.s[p.pos:], "//"):
+			end := strings.IndexAny(p.s[p.pos:], "\n\r\u2028\u2029")
+			if end < 0 {
+				end = len(p.s) - p.pos
+			}
+			p.pos += end
+		case strings.HasPrefix(p.s[p.pos:], "/*"):
+			end := strings.Index(p.s[p.pos+2:], "*/")
+			if end < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *json5Parser) value(depth int) (interface{}, error) {
+	if depth > maxJSON5Depth {
+		return nil, p.errorf("data nested too deeply")
+	}
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.pos >= len(p.s) {
+		return nil, p.unexpected("a value")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '{':
+		return p.object(depth)
+	case c == '[':
+		return p.array(depth)
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9') || strings.HasPrefix(p.s[p.pos:], "Infinity") || strings.HasPrefix(p.s[p.pos:], "NaN"):
+		return p.number()
+	}
+	for _, lit := range []struct {
+		word  string
+		value interface{}
+	}{{"true", true}, {"false", false}, {"null", nil}} {
+		if strings.HasPrefix(p.s[p.pos:], lit.word) && !p.identifierAt(p.pos+len(lit.word)) {
+			p.pos += len(lit.word)
+			return lit.value, nil
+		}
+	}
+	return nil, p.unexpected("a value")
+}
+
+// identifierAt reports whether an identifier character follows at i, so
+// that `nullable` is not read as null.
+func (p *json5Parser) identifierAt(i int) bool {
+	if i >= len(p.s) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(p.s[i:])
+	return isJSON5IdentRune(r, false)
+}
+
+func (p *json5Parser) object(depth int) (interface{}, error) {
+	obj := toon.NewObject()
+	p.pos++ // '{'
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.s) && p.s[p.pos] == '}' {
+			p.pos++
+			return obj, nil
+		}
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.s) || p.s[p.pos] != ':' {
+			return nil, p.unexpected("':' after object key")
+		}
+		p.pos++
+		v, err := p.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(key, v)
+
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.pos < len(p.s) && p.s[p.pos] == ',':
+			p.pos++
+		case p.pos < len(p.s) && p.s[p.pos] == '}':
+		default:
+			return nil, p.unexpected("',' or '}'")
+		}
+	}
+}
+
+// key reads a quoted key or an unquoted identifier.
+func (p *json5Parser) key() (string, error) {
+	if p.pos < len(p.s) && (p.s[p.pos] == '"' || p.s[p.pos] == '\'') {
+		return p.str()
+	}
+	start := p.pos
+	for p.pos < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		if !isJSON5IdentRune(r, p.pos == start) {
+			break
+		}
+		p.pos += size
+	}
+	if p.pos == start {
+		return "", p.unexpected("an object key")
+	}
+	return p.s[start:p.pos], nil
+}
+
+// isJSON5IdentRune reports whether r may appear in an unquoted key; digits
+// are not allowed first.
+func isJSON5IdentRune(r rune, first bool) bool {
+	switch {
+	case r == '$' || r == '_' || unicode.IsLetter(r):
+		return true
+	case first:
+		return false
+	}
+	return unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r) || unicode.Is(unicode.Pc, r) || r == '\u200c' || r == '\u200d'
+}
+
+func (p *json5Parser) array(depth int) (interface{}, error) {
+	arr := []interface{}{}
+	p.pos++ // '['
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.s) && p.s[p.pos] == ']' {
+			p.pos++
+			return arr, nil
+		}
+		v, err := p.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.pos < len(p.s) && p.s[p.pos] == ',':
+			p.pos++
+		case p.pos < len(p.s) && p.s[p.pos] == ']':
+		default:
+			return nil, p.unexpected("',' or ']'")
+		}
+	}
+}
+
+// str reads a single- or double-quoted string with JavaScript escapes.
+func (p *json5Parser) str() (string, error) {
+	quote := p.s[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\n' || c == '\r':
+			return "", p.errorf("unescaped line break in string")
+		case c != '\\':
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		p.pos++ // '\'
+		if p.pos >= len(p.s) {
+			break
+		}
+		e := p.s[p.pos]
+		p.pos++
+		switch e {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '0':
+			if p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+				return "", p.errorf("octal escapes are not allowed")
+			}
+			b.WriteByte(0)
+		case 'x':
+			n, err := p.hex(2)
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(rune(n))
+		case 'u':
+			n, err := p.hex(4)
+			if err != nil {
+				return "", err
+			}
+			r := rune(n)
+			// Combine a surrogate pair into one character
+			if r >= 0xd800 && r < 0xdc00 && strings.HasPrefix(p.s[p.pos:], `\u`) {
+				save := p.pos
+				p.pos += 2
+				if low, err := p.hex(4); err == nil && low >= 0xdc00 && low < 0xe000 {
+					r = 0x10000 + (r-0xd800)<<10 + (rune(low) - 0xdc00)
+				} else {
+					p.pos = save
+				}
+			}
+			b.WriteRune(r)
+		case '\r':
+			// A backslash before a line break continues the string
+			if p.pos < len(p.s) && p.s[p.pos] == '\n' {
+				p.pos++
+			}
+		case '\n':
+		default:
+			if e >= '1' && e <= '9' {
+				return "", p.errorf("octal escapes are not allowed")
+			}
+			// Any other character stands for itself, including multi-byte ones
+			p.pos--
+			r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+			if r != '\u2028' && r != '\u2029' {
+				b.WriteRune(r)
+			}
+			p.pos += size
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// hex reads n hexadecimal digits.
+func (p *json5Parser) hex(n int) (uint64, error) {
+	if p.pos+n > len(p.s) {
+		return 0, p.errorf("incomplete escape sequence")
+	}
+	v, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid escape sequence %q", p.s[p.pos:p.pos+n])
+	}
+	p.pos += n
+	return v, nil
+}
+
+// number reads a decimal or hexadecimal number, Infinity or NaN, and
+// returns it in JSON form.
+func (p *json5Parser) number() (interface{}, error) {
+	start := p.pos
+	sign := ""
+	if c := p.s[p.pos]; c == '+' || c == '-' {
+		if c == '-' {
+			sign = "-"
+		}
+		p.pos++
+	}
+	rest := p.s[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "Infinity"), strings.HasPrefix(rest, "NaN"):
+		word := "Infinity"
+		if rest[0] == 'N' {
+			word = "NaN"
+		}
+		p.pos += len(word)
+		if p.identifierAt(p.pos) {
+			p.pos = start
+			return nil, p.unexpected("a value")
+		}
+		return nil, nil
+
+	case len(rest) > 2 && rest[0] == '0' && (rest[1] == 'x' || rest[1] == 'X'):
+		p.pos += 2
+		digits := p.pos
+		for p.pos < len(p.s) && strings.IndexByte("0123456789abcdefABCDEF", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		n, ok := new(big.Int).SetString(p.s[digits:p.pos], 16)
+		if !ok {
+			return nil, p.unexpected("hexadecimal digits")
+		}
+		if p.identifierAt(p.pos) {
+			return nil, p.unexpected("the end of the number")
+		}
+		return json.Number(sign + n.String()), nil
+	}
+
+	digits := p.pos
+	for p.pos < len(p.s) && strings.IndexByte("0123456789.eE+-", p.s[p.pos]) >= 0 {
+		// A sign is only part of the number right after the exponent marker
+		if c := p.s[p.pos]; (c == '+' || c == '-') && p.s[p.pos-1] != 'e' && p.s[p.pos-1] != 'E' {
+			break
+		}
+		p.pos++
+	}
+	text := p.s[digits:p.pos]
+	if p.identifierAt(p.pos) {
+		return nil, p.unexpected("the end of the number")
+	}
+
+	// Normalize .5 and 5. to JSON form
+	mant, exp, hasExp := strings.Cut(strings.ToLower(text), "e")
+	if strings.HasPrefix(mant, ".") {
+		mant = "0" + mant
+	}
+	mant = strings.TrimSuffix(mant, ".")
+	normalized := sign + mant
+	if hasExp {
+		normalized += "e" + exp
+	}
+	if !jsonNumber.MatchString(normalized) {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", p.s[start:digits]+text)
+	}
+	return json.Number(normalized), nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestJSON5Values(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "comments and trailing commas",
+			input: "// settings\n{\n  /* editor */\n  \"editor.tabSize\": 2, // spaces\n  \"files.exclude\": [\"dist\", \"out\",],\n}\n",
+			want:  `{"editor.tabSize":2,"files.exclude":["dist","out"]}` + "\n",
+		},
+		{
+			name:  "unquoted keys and single-quoted strings",
+			input: `{target: 'es2020', $schema: 'x', _a1: "it's", 'b': 'say "hi"'}`,
+			want:  `{"target":"es2020","$schema":"x","_a1":"it's","b":"say \"hi\""}` + "\n",
+		},
+		{
+			name:  "number forms",
+			input: `[0xFF, -0x10, .5, 5., +3, 1e3, -0.25E-2]`,
+			want:  `[255,-16,0.5,5,3,1e3,-0.25e-2]` + "\n",
+		},
+		{
+			name:  "Infinity and NaN become null",
+			input: `{inf: Infinity, ninf: -Infinity, pinf: +Infinity, nan: NaN}`,
+			want:  `{"inf":null,"ninf":null,"pinf":null,"nan":null}` + "\n",
+		},
+		{
+			name:  "overflowing numbers are kept as with JSON input",
+			input: `{big: 1e999, small: -.5E400}`,
+			want:  `{"big":1e999,"small":-0.5e400}` + "\n",
+		},
+		{
+			name:  "escapes and line continuations",
+			input: "'\\x41\\u00e9\\ud83d\\ude00\\v\\0 a\\\nb'",
+			want:  `"Aé😀\u000b\u0000 ab"` + "\n",
+		},
+		{
+			name:  "plain JSON and several values",
+			input: `{"a":[1,true,null]} "x"`,
+			want:  `{"a":[1,true,null]}` + "\n" + `"x"` + "\n",
+		},
+		{
+			name:    "missing comma",
+			input:   `{a: 1 b: 2}`,
+			wantErr: true,
+		},
+		{
+			name:    "leading zero",
+			input:   `[01]`,
+			wantErr: true,
+		},
+		{
+			name:    "keyword prefix",
+			input:   `[nullable]`,
+			wantErr: true,
+		},
+		{
+			name:    "unterminated comment",
+			input:   `{a: 1} /* open`,
+			wantErr: true,
+		},
+		{
+			name:    "line break in string",
+			input:   "'a\nb'",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated object",
+			input:   `{a: 1,`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json5Values([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("json5Values() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("json5Values() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
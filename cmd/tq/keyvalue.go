@@ -0,0 +1,642 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// keyCases lists the values accepted by --key-case.
+var keyCases = []string{"upper", "lower", "preserve"}
+
+// keyValueOptions controls how nested objects map to the flat keys of
+// dotenv, Java properties and INI files.
+type keyValueOptions struct {
+	separator string // joins nested keys; empty selects the format's default
+	keyCase   string // one of keyCases; empty selects the format's default
+}
+
+// separatorFor returns the key separator for format: "_" for dotenv
+// (DATABASE_HOST) and "." otherwise (database.host).
+func (o keyValueOptions) separatorFor(format string) string {
+	if o.separator != "" {
+		return o.separator
+	}
+	if format == "dotenv" {
+		return "_"
+	}
+	return "."
+}
+
+// caseFor returns the key case for format: environment variables are
+// conventionally upper case, other keys are kept as they are.
+func (o keyValueOptions) caseFor(format string) string {
+	if o.keyCase != "" {
+		return o.keyCase
+	}
+	if format == "dotenv" {
+		return "upper"
+	}
+	return "preserve"
+}
+
+func applyKeyCase(k, keyCase string) string {
+	switch keyCase {
+	case "upper":
+		return strings.ToUpper(k)
+	case "lower":
+		return strings.ToLower(k)
+	}
+	return k
+}
+
+// toKeyValue renders one JSON object as a dotenv, Java properties or INI
+// file. Nested fields are flattened into keys joined by the separator.
+// In INI files each top-level object becomes a [section]; the other
+// top-level fields come first, outside any section.
+func toKeyValue(jsonInput, format string, opts keyValueOptions) (string, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	obj, ok := v.(*toon.Object)
+	if !ok {
+		return "", fmt.Errorf("%s output needs an object, got %s", format, jsonType(v))
+	}
+	sep, keyCase := opts.separatorFor(format), opts.caseFor(format)
+
+	var b strings.Builder
+	writeEntries := func(flat *toon.Object) error {
+		for _, k := range flat.Keys() {
+			val, _ := flat.Get(k)
+			s, err := csvCell(val)
+			if err != nil {
+				return err
+			}
+			k = applyKeyCase(k, keyCase)
+			switch format {
+			case "dotenv":
+				fmt.Fprintf(&b, "%s=%s\n", envName(k), envValue(val, s))
+			case "properties":
+				fmt.Fprintf(&b, "%s=%s\n", propertiesEscape(k, true), propertiesEscape(s, false))
+			default: // "ini"
+				fmt.Fprintf(&b, "%s = %s\n", k, iniValue(val, s))
+			}
+		}
+		return nil
+	}
+
+	if format != "ini" {
+		flat := toon.NewObject()
+		flattenInto(flat, "", sep, obj)
+		err := writeEntries(flat)
+		return b.String(), err
+	}
+
+	global := toon.NewObject()
+	var sections []string
+	for _, k := range obj.Keys() {
+		val, _ := obj.Get(k)
+		if _, ok := val.(*toon.Object); ok {
+			sections = append(sections, k)
+			continue
+		}
+		flattenInto(global, k, sep, val)
+	}
+	if err := writeEntries(global); err != nil {
+		return "", err
+	}
+	for _, k := range sections {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", applyKeyCase(k, keyCase))
+		val, _ := obj.Get(k)
+		flat := toon.NewObject()
+		flattenInto(flat, "", sep, val)
+		if err := writeEntries(flat); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// envNameInvalid matches characters that cannot appear in an environment
+// variable name.
+var envNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// envName turns a flattened key into a valid variable name.
+func envName(k string) string {
+	k = envNameInvalid.ReplaceAllString(k, "_")
+	if k == "" || (k[0] >= '0' && k[0] <= '9') {
+		k = "_" + k
+	}
+	return k
+}
+
+// envSafe matches values that need no quoting in a shell.
+var envSafe = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]+$`)
+
+// envValue quotes a dotenv value so that it reads back the same both when
+// the file is sourced by a shell and when it is loaded by dotenv tools.
+// Strings that would read back as numbers or booleans are quoted too.
+func envValue(v interface{}, s string) string {
+	if _, isString := v.(string); !isString || (envSafe.MatchString(s) && inferCell(s, false) == s) {
+		return s
+	}
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(s) + `"`
+}
+
+// propertiesEscape escapes a key or value for a Java properties file.
+// Characters outside printable ASCII are written as \uXXXX, so the file
+// reads back the same in the ISO 8859-1 encoding Java assumes.
+func propertiesEscape(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == ' ' && (key || i == 0):
+			b.WriteString(`\ `)
+		case key && strings.ContainsRune("=:#!", r), !key && i == 0 && (r == '#' || r == '!'):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			var units [2]rune
+			n := 1
+			units[0] = r
+			if r > 0xffff {
+				r -= 0x10000
+				units[0], units[1] = 0xd800+(r>>10), 0xdc00+(r&0x3ff)
+				n = 2
+			}
+			for _, u := range units[:n] {
+				fmt.Fprintf(&b, `\u%04x`, u)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// iniValue quotes an INI value when it would otherwise lose characters or
+// read back as a different type.
+func iniValue(v interface{}, s string) string {
+	_, isString := v.(string)
+	if !isString || s == "" {
+		return s
+	}
+	if s == strings.TrimSpace(s) && !strings.ContainsAny(s, ";#\"'\\\n\r") && inferCell(s, false) == s {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// keyValueReader collects the entries of a dotenv, properties or INI file
+// into an object, splitting keys on the separator into nested objects.
+type keyValueReader struct {
+	root    *toon.Object
+	sep     string // empty keeps keys flat
+	noInfer bool
+}
+
+// set stores v under key in obj. If part of the path is already taken by
+// a value that is not an object, the key is stored unsplit instead.
+func (r *keyValueReader) set(obj *toon.Object, key string, v interface{}) {
+	parts := []string{key}
+	if r.sep != "" {
+		parts = strings.Split(key, r.sep)
+	}
+	target := obj
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := target.Get(p)
+		if !ok {
+			child := toon.NewObject()
+			target.Set(p, child)
+			target = child
+			continue
+		}
+		child, ok := next.(*toon.Object)
+		if !ok {
+			obj.Set(key, v)
+			return
+		}
+		target = child
+	}
+	last := parts[len(parts)-1]
+	if existing, ok := target.Get(last); ok && len(parts) > 1 {
+		if _, isObject := existing.(*toon.Object); isObject {
+			obj.Set(key, v)
+			return
+		}
+	}
+	target.Set(last, v)
+}
+
+// value converts an unquoted value, inferring numbers and booleans.
+func (r *keyValueReader) value(s string) interface{} {
+	return inferCell(s, r.noInfer)
+}
+
+// result returns the collected object as a JSON line. Objects whose keys
+// are exactly 0..n-1, as written for flattened arrays, become arrays again.
+func (r *keyValueReader) result() (string, error) {
+	for _, k := range r.root.Keys() {
+		v, _ := r.root.Get(k)
+		r.root.Set(k, restoreArrays(v))
+	}
+	s, err := compactJSON(r.root)
+	if err != nil {
+		return "", err
+	}
+	return s + "\n", nil
+}
+
+func restoreArrays(v interface{}) interface{} {
+	obj, ok := v.(*toon.Object)
+	if !ok {
+		return v
+	}
+	keys := obj.Keys()
+	for _, k := range keys {
+		val, _ := obj.Get(k)
+		obj.Set(k, restoreArrays(val))
+	}
+	if len(keys) == 0 {
+		return obj
+	}
+	indexes := make([]int, len(keys))
+	for i, k := range keys {
+		n, err := strconv.Atoi(k)
+		if err != nil || strconv.Itoa(n) != k {
+			return obj
+		}
+		indexes[i] = n
+	}
+	sort.Ints(indexes)
+	for i, n := range indexes {
+		if n != i {
+			return obj
+		}
+	}
+	arr := make([]interface{}, len(keys))
+	for i := range arr {
+		arr[i], _ = obj.Get(strconv.Itoa(i))
+	}
+	return arr
+}
+
+// dotenvValues parses a dotenv file into a single object. Lines hold
+// KEY=VALUE, optionally after `export`; values may be single-quoted
+// (literal), double-quoted (with backslash escapes, possibly spanning
+// lines) or bare, where a # after whitespace starts a comment. Keys stay
+// flat unless --key-separator is given.
+func dotenvValues(data []byte, opts *options) (string, error) {
+	r := &keyValueReader{root: toon.NewObject(), sep: opts.kv.separator, noInfer: opts.csv.noInfer}
+	s := strings.TrimPrefix(string(data), "\xef\xbb\xbf")
+	line := 1
+	for pos := 0; pos < len(s); {
+		// Skip blank lines and comments
+		switch c := s[pos]; {
+		case c == '\n':
+			line++
+			pos++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			pos++
+			continue
+		case c == '#':
+			for pos < len(s) && s[pos] != '\n' {
+				pos++
+			}
+			continue
+		}
+
+		end := strings.IndexByte(s[pos:], '\n')
+		if end < 0 {
+			end = len(s) - pos
+		}
+		rest := strings.TrimPrefix(s[pos:pos+end], "export ")
+		key, _, found := strings.Cut(rest, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return "", fmt.Errorf("line %d: expected KEY=VALUE", line)
+		}
+		pos += strings.Index(s[pos:], "=") + 1
+		for pos < len(s) && (s[pos] == ' ' || s[pos] == '\t') {
+			pos++
+		}
+
+		var v interface{}
+		start := line
+		if pos < len(s) && (s[pos] == '\'' || s[pos] == '"') {
+			quote := s[pos]
+			var b strings.Builder
+			pos++
+			closed := false
+			for pos < len(s) && !closed {
+				c := s[pos]
+				pos++
+				switch {
+				case c == quote:
+					closed = true
+				case c == '\\' && quote == '"' && pos < len(s):
+					e := s[pos]
+					pos++
+					switch e {
+					case 'n':
+						b.WriteByte('\n')
+					case 'r':
+						b.WriteByte('\r')
+					case 't':
+						b.WriteByte('\t')
+					case '\\', '"', '$', '`':
+						b.WriteByte(e)
+					case '\n':
+						// A backslash-newline continues the line
+						line++
+					default:
+						b.WriteByte('\\')
+						b.WriteByte(e)
+					}
+				default:
+					if c == '\n' {
+						line++
+					}
+					b.WriteByte(c)
+				}
+			}
+			if !closed {
+				return "", fmt.Errorf("line %d: unterminated %c-quoted value", start, quote)
+			}
+			// Only a comment may follow the closing quote
+			tail := s[pos:]
+			if i := strings.IndexByte(tail, '\n'); i >= 0 {
+				tail = tail[:i]
+			}
+			if t := strings.TrimSpace(tail); t != "" && !strings.HasPrefix(t, "#") {
+				return "", fmt.Errorf("line %d: unexpected %q after quoted value", line, t)
+			}
+			pos += len(tail)
+			v = b.String()
+		} else {
+			end := strings.IndexByte(s[pos:], '\n')
+			if end < 0 {
+				end = len(s) - pos
+			}
+			raw := s[pos : pos+end]
+			pos += end
+			if i := strings.Index(raw, " #"); i >= 0 {
+				raw = raw[:i]
+			}
+			if i := strings.Index(raw, "\t#"); i >= 0 {
+				raw = raw[:i]
+			}
+			v = r.value(strings.TrimSpace(raw))
+		}
+		r.set(r.root, key, v)
+	}
+	return r.result()
+}
+
+// propertiesValues parses a Java properties file into a single object.
+// Keys are split on the separator (default "."), so database.host=x
+// becomes {"database":{"host":"x"}}.
+func propertiesValues(data []byte, opts *options) (string, error) {
+	r := &keyValueReader{root: toon.NewObject(), sep: opts.kv.separatorFor("properties"), noInfer: opts.csv.noInfer}
+	lines := strings.Split(strings.TrimPrefix(string(data), "\xef\xbb\xbf"), "\n")
+	for i := 0; i < len(lines); i++ {
+		num := i + 1
+		logical := strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+		if logical == "" || logical[0] == '#' || logical[0] == '!' {
+			continue
+		}
+		// An odd number of trailing backslashes continues the line
+		for trailingBackslashes(logical)%2 == 1 && i+1 < len(lines) {
+			i++
+			logical = logical[:len(logical)-1] + strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+		}
+
+		// The key ends at the first unescaped '=', ':' or whitespace
+		end := len(logical)
+		for j := 0; j < len(logical); j++ {
+			if logical[j] == '\\' {
+				j++
+				continue
+			}
+			if strings.IndexByte("=: \t\f", logical[j]) >= 0 {
+				end = j
+				break
+			}
+		}
+		key, rest := logical[:end], strings.TrimLeft(logical[end:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+		k, err := propertiesUnescape(key)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %v", num, err)
+		}
+		v, err := propertiesUnescape(rest)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %v", num, err)
+		}
+		r.set(r.root, k, r.value(v))
+	}
+	return r.result()
+}
+
+func trailingBackslashes(s string) int {
+	n := 0
+	for n < len(s) && s[len(s)-1-n] == '\\' {
+		n++
+	}
+	return n
+}
+
+// propertiesUnescape decodes the escapes of a properties key or value.
+func propertiesUnescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	var high rune // pending high surrogate
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("malformed \\u escape")
+			}
+			n, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\u escape %q", s[i-1:i+5])
+			}
+			i += 4
+			r := rune(n)
+			switch {
+			case r >= 0xd800 && r < 0xdc00:
+				high = r
+				continue
+			case r >= 0xdc00 && r < 0xe000 && high != 0:
+				r = 0x10000 + (high-0xd800)<<10 + (r - 0xdc00)
+			}
+			if !utf8.ValidRune(r) {
+				r = utf8.RuneError
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(s[i])
+		}
+		high = 0
+	}
+	return b.String(), nil
+}
+
+// iniValues parses an INI file into a single object. Entries before the
+// first [section] are top-level fields; section names and keys are split
+// on the separator (default "."). Values may be double-quoted with
+// backslash escapes or single-quoted; in bare values ; or # after
+// whitespace starts a comment.
+func iniValues(data []byte, opts *options) (string, error) {
+	r := &keyValueReader{root: toon.NewObject(), sep: opts.kv.separatorFor("ini"), noInfer: opts.csv.noInfer}
+	section := r.root
+	for i, raw := range strings.Split(strings.TrimPrefix(string(data), "\xef\xbb\xbf"), "\n") {
+		num := i + 1
+		line := strings.TrimSpace(raw)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return "", fmt.Errorf("line %d: unterminated section header", num)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return "", fmt.Errorf("line %d: empty section name", num)
+			}
+			section = r.section(name)
+			if section == nil {
+				return "", fmt.Errorf("line %d: section [%s] conflicts with an existing value", num, name)
+			}
+			continue
+		}
+
+		sepIdx := strings.IndexAny(line, "=:")
+		if sepIdx <= 0 {
+			return "", fmt.Errorf("line %d: expected key = value", num)
+		}
+		key := strings.TrimSpace(line[:sepIdx])
+		val := strings.TrimSpace(line[sepIdx+1:])
+		var v interface{}
+		switch {
+		case len(val) >= 2 && val[0] == '"':
+			s, rest, err := iniQuoted(val)
+			if err != nil {
+				return "", fmt.Errorf("line %d: %v", num, err)
+			}
+			if rest = strings.TrimSpace(rest); rest != "" && rest[0] != ';' && rest[0] != '#' {
+				return "", fmt.Errorf("line %d: unexpected %q after quoted value", num, rest)
+			}
+			v = s
+		case len(val) >= 2 && val[0] == '\'' && strings.LastIndexByte(val, '\'') > 0:
+			v = val[1:strings.LastIndexByte(val, '\'')]
+		default:
+			for _, marker := range []string{" ;", "\t;", " #", "\t#"} {
+				if i := strings.Index(val, marker); i >= 0 {
+					val = val[:i]
+				}
+			}
+			v = r.value(strings.TrimSpace(val))
+		}
+		r.set(section, key, v)
+	}
+	return r.result()
+}
+
+// section returns the object for a section name, creating it and its
+// parents as needed, or nil if the path is taken by another value.
+func (r *keyValueReader) section(name string) *toon.Object {
+	parts := []string{name}
+	if r.sep != "" {
+		parts = strings.Split(name, r.sep)
+	}
+	obj := r.root
+	for _, p := range parts {
+		next, ok := obj.Get(p)
+		if !ok {
+			child := toon.NewObject()
+			obj.Set(p, child)
+			obj = child
+			continue
+		}
+		child, ok := next.(*toon.Object)
+		if !ok {
+			return nil
+		}
+		obj = child
+	}
+	return obj
+}
+
+// iniQuoted reads a double-quoted value at the start of s and returns it
+// with the text that follows.
+func iniQuoted(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i+1 >= len(s) {
+				break
+			}
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted value")
+}
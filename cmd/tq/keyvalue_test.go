@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestToKeyValue(t *testing.T) {
+	const config = `{"app":"demo","port":8080,"debug":true,"db":{"host":"db.local","pool":{"max":10}},"tags":["a","b"]}`
+	tests := []struct {
+		name    string
+		input   string
+		format  string
+		opts    keyValueOptions
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "dotenv",
+			input:  config,
+			format: "dotenv",
+			want:   "APP=demo\nPORT=8080\nDEBUG=true\nDB_HOST=db.local\nDB_POOL_MAX=10\nTAGS_0=a\nTAGS_1=b\n",
+		},
+		{
+			name:   "dotenv with custom separator and case",
+			input:  `{"db":{"host":"x"},"api-key":"k"}`,
+			format: "dotenv",
+			opts:   keyValueOptions{separator: "__", keyCase: "preserve"},
+			want:   "db__host=x\napi_key=k\n",
+		},
+		{
+			name:   "dotenv quoting",
+			input:  `{"a":"two words","b":"it's $HOME","c":"","d":"42","e":null,"f":"x=y"}`,
+			format: "dotenv",
+			want:   "A='two words'\nB=\"it's \\$HOME\"\nC=''\nD='42'\nE=\nF=x=y\n",
+		},
+		{
+			name:   "properties",
+			input:  config,
+			format: "properties",
+			want:   "app=demo\nport=8080\ndebug=true\ndb.host=db.local\ndb.pool.max=10\ntags.0=a\ntags.1=b\n",
+		},
+		{
+			name:   "properties escapes",
+			input:  `{"a key":" lead","b=c":"caf\u00e9\n#x","d":"#hash"}`,
+			format: "properties",
+			want:   "a\\ key=\\ lead\nb\\=c=caf\\u00e9\\n#x\nd=\\#hash\n",
+		},
+		{
+			name:   "ini sections",
+			input:  config,
+			format: "ini",
+			want:   "app = demo\nport = 8080\ndebug = true\ntags.0 = a\ntags.1 = b\n\n[db]\nhost = db.local\npool.max = 10\n",
+		},
+		{
+			name:   "ini quoting and upper case",
+			input:  `{"s":{"a":"x ; y","b":"true","c":" pad"}}`,
+			format: "ini",
+			opts:   keyValueOptions{keyCase: "upper"},
+			want:   "[S]\nA = \"x ; y\"\nB = \"true\"\nC = \" pad\"\n",
+		},
+		{
+			name:    "not an object",
+			input:   `[1,2]`,
+			format:  "dotenv",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toKeyValue(tt.input, tt.format, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toKeyValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("toKeyValue() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyValueValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		opts    options
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "dotenv",
+			format: "dotenv",
+			input:  "# config\nexport PORT=8080\nDEBUG=true\nNAME=demo app # comment\nEMPTY=\n",
+			want:   `{"PORT":8080,"DEBUG":true,"NAME":"demo app","EMPTY":""}` + "\n",
+		},
+		{
+			name:   "dotenv quoting",
+			format: "dotenv",
+			input:  "A='lit $x # not a comment'\nB=\"multi\nline \\\"q\\\" \\$y\"\nC=\"42\"\n",
+			want:   `{"A":"lit $x # not a comment","B":"multi\nline \"q\" $y","C":"42"}` + "\n",
+		},
+		{
+			name:   "dotenv with key separator",
+			format: "dotenv",
+			input:  "DB__HOST=x\nDB__PORT=5432\n",
+			opts:   options{kv: keyValueOptions{separator: "__"}},
+			want:   `{"DB":{"HOST":"x","PORT":5432}}` + "\n",
+		},
+		{
+			name:    "dotenv without equals sign",
+			format:  "dotenv",
+			input:   "PORT 8080\n",
+			wantErr: true,
+		},
+		{
+			name:    "dotenv unterminated quote",
+			format:  "dotenv",
+			input:   "A='open\n",
+			wantErr: true,
+		},
+		{
+			name:   "properties",
+			format: "properties",
+			input:  "! comment\n# comment\ndb.host = db.local\ndb.port: 5432\ngreeting hello \\\n    world\nnote=caf\\u00e9\\tx\nkey\\ with\\=sep=1\ntags.0=a\ntags.1=b\n",
+			want:   `{"db":{"host":"db.local","port":5432},"greeting":"hello world","note":"café\tx","key with=sep":1,"tags":["a","b"]}` + "\n",
+		},
+		{
+			name:   "properties conflicting keys stay flat",
+			format: "properties",
+			input:  "a=1\na.b=2\n",
+			want:   `{"a":1,"a.b":2}` + "\n",
+		},
+		{
+			name:   "properties without inference",
+			format: "properties",
+			input:  "port=8080\n",
+			opts:   options{csv: csvOptions{noInfer: true}},
+			want:   `{"port":"8080"}` + "\n",
+		},
+		{
+			name:   "ini",
+			format: "ini",
+			input:  "; top\nname = demo\n\n[db]\nhost = db.local ; inline\nport = 5432\n[db.pool]\nmax: 10\n[paths]\nhome = \"C:\\\\Users\\\\me\"\nraw = 'a ; b'\n",
+			want:   `{"name":"demo","db":{"host":"db.local","port":5432,"pool":{"max":10}},"paths":{"home":"C:\\Users\\me","raw":"a ; b"}}` + "\n",
+		},
+		{
+			name:    "ini unterminated section",
+			format:  "ini",
+			input:   "[db\n",
+			wantErr: true,
+		},
+		{
+			name:    "ini line without value",
+			format:  "ini",
+			input:   "[db]\nhost\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeInput(tt.format, []byte(tt.input), &tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decodeInput() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// logfmtLine matches the start of a logfmt record such as `level=info`,
+// used to recognize piped log output.
+var logfmtLine = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*=`)
+
+// logfmtValues converts logfmt input, one record per line, to one JSON
+// object per line. Values may be bare or double-quoted with Go-style
+// escapes; a key without `=` is true. Bare values are inferred as numbers
+// and booleans unless noInfer is set, and quoted values stay strings.
+func logfmtValues(data []byte, noInfer bool) (string, error) {
+	var out strings.Builder
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		obj, err := parseLogfmt(line, noInfer)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %v", i+1, err)
+		}
+		s, err := compactJSON(obj)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(s)
+		out.WriteByte('\n')
+	}
+	return out.String(), nil
+}
+
+// parseLogfmt reads the key/value pairs of one line. A repeated key keeps
+// its last value.
+func parseLogfmt(line string, noInfer bool) (*toon.Object, error) {
+	obj := toon.NewObject()
+	for pos := 0; pos < len(line); {
+		if c := line[pos]; c == ' ' || c == '\t' {
+			pos++
+			continue
+		}
+		start := pos
+		for pos < len(line) && line[pos] > ' ' && line[pos] != '=' && line[pos] != '"' {
+			pos++
+		}
+		key := line[start:pos]
+		if key == "" {
+			return nil, fmt.Errorf("column %d: expected a key, found %q", pos+1, line[pos])
+		}
+		if pos >= len(line) || line[pos] != '=' {
+			if pos < len(line) && line[pos] == '"' {
+				return nil, fmt.Errorf("column %d: unexpected quote in key %q", pos+1, key)
+			}
+			obj.Set(key, true)
+			continue
+		}
+		pos++
+
+		if pos < len(line) && line[pos] == '"' {
+			end, err := logfmtQuotedEnd(line, pos)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %v", key, err)
+			}
+			s, err := strconv.Unquote(line[pos:end])
+			if err != nil {
+				return nil, fmt.Errorf("key %s: invalid quoted value %s", key, line[pos:end])
+			}
+			obj.Set(key, s)
+			pos = end
+			continue
+		}
+		start = pos
+		for pos < len(line) && line[pos] != ' ' && line[pos] != '\t' {
+			pos++
+		}
+		obj.Set(key, inferCell(line[start:pos], noInfer))
+	}
+	return obj, nil
+}
+
+// logfmtQuotedEnd returns the offset just past the closing quote of the
+// quoted value starting at line[start].
+func logfmtQuotedEnd(line string, start int) (int, error) {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quoted value")
+}
+
+// toLogfmt renders one JSON value as logfmt: an object becomes one line,
+// and an array of objects one line per element. Nested fields are
+// flattened into dotted keys.
+func toLogfmt(jsonInput string) (string, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	records, isArray := v.([]interface{})
+	if !isArray {
+		records = []interface{}{v}
+	}
+
+	var b strings.Builder
+	for i, rec := range records {
+		obj, ok := rec.(*toon.Object)
+		if !ok {
+			if isArray {
+				return "", fmt.Errorf("record %d: logfmt output needs objects, got %s", i+1, jsonType(rec))
+			}
+			return "", fmt.Errorf("logfmt output needs an object or an array of objects, got %s", jsonType(rec))
+		}
+		flat := toon.NewObject()
+		flattenInto(flat, "", ".", obj)
+		pairs := make([]string, 0, flat.Len())
+		for _, k := range flat.Keys() {
+			val, _ := flat.Get(k)
+			s, err := csvCell(val)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, logfmtKey(k)+"="+logfmtValue(val, s))
+		}
+		b.WriteString(strings.Join(pairs, " "))
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// logfmtKey replaces the characters a key cannot contain.
+func logfmtKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+// logfmtValue quotes a value that contains spaces, quotes, '=' or control
+// characters, or a string that would read back as a number or boolean.
+func logfmtValue(v interface{}, s string) string {
+	if _, isString := v.(string); !isString {
+		return s
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\\") || inferCell(s, false) != s || strings.IndexFunc(s, func(r rune) bool { return r < ' ' }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLogfmtValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		noInfer bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "records with inferred values",
+			input: "level=info msg=\"server started\" port=8080\n\nlevel=error msg=\"db timeout\" retry dur=1.5s ok=false\n",
+			want:  `{"level":"info","msg":"server started","port":8080}` + "\n" + `{"level":"error","msg":"db timeout","retry":true,"dur":"1.5s","ok":false}` + "\n",
+		},
+		{
+			name:  "escapes, empty values and quoted numbers",
+			input: `msg="say \"hi\"\n" empty= quoted="42" tab=a	b=c`,
+			want:  `{"msg":"say \"hi\"\n","empty":"","quoted":"42","tab":"a","b":"c"}` + "\n",
+		},
+		{
+			name:    "no inference",
+			input:   "port=8080 ok=true",
+			noInfer: true,
+			want:    `{"port":"8080","ok":"true"}` + "\n",
+		},
+		{
+			name:    "unterminated quote",
+			input:   "level=info\nmsg=\"open",
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			input:   "=value",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := logfmtValues([]byte(tt.input), tt.noInfer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("logfmtValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("logfmtValues() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToLogfmt(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "object",
+			input: `{"level":"error","msg":"db timeout","status":503,"retry":true}`,
+			want:  "level=error msg=\"db timeout\" status=503 retry=true\n",
+		},
+		{
+			name:  "array of objects",
+			input: `[{"a":1},{"a":2,"b":"x"}]`,
+			want:  "a=1\na=2 b=x\n",
+		},
+		{
+			name:  "nested values, nulls and ambiguous strings",
+			input: `{"req":{"path":"/a b","id":"42"},"err":null,"empty":"","k=v":"x"}`,
+			want:  "req.path=\"/a b\" req.id=\"42\" err= empty=\"\" k_v=x\n",
+		},
+		{
+			name:    "scalar",
+			input:   `"x"`,
+			wantErr: true,
+		},
+		{
+			name:    "array of scalars",
+			input:   `[{"a":1},2]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toLogfmt(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toLogfmt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("toLogfmt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,175 +1,336 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
 )
 
 const version = "0.2.0"
 
 func main() {
-	if len(os.Args) > 1 && (os.Args[1] == "-v" || os.Args[1] == "--version") {
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Try 'tq --help' for more information\n")
+		os.Exit(2)
+	}
+
+	if opts.showVersion {
 		fmt.Printf("tq version %s\n", version)
 		os.Exit(0)
 	}
 
-	if len(os.Args) > 1 && (os.Args[1] == "-h" || os.Args[1] == "--help") {
+	if opts.showHelp {
 		printHelp()
 		os.Exit(0)
 	}
 
-	// Parse command-line flags
-	filter := "."
-	outputFormat := "toon" // toon, json, compact, raw
-	colorOutput := false
-	var inputFile string
-	filterSet := false
-
-	args := os.Args[1:]
-	for i := 0; i < len(args); i++ {
-		arg := args[i]
-		if arg == "--json" {
-			outputFormat = "json"
-		} else if arg == "--compact" || arg == "-c" {
-			outputFormat = "compact"
-		} else if arg == "--raw" || arg == "-r" {
-			outputFormat = "raw"
-		} else if arg == "--color" || arg == "-C" {
-			colorOutput = true
-		} else if arg == "--no-color" || arg == "-M" {
-			colorOutput = false
-		} else if !strings.HasPrefix(arg, "-") && !filterSet {
-			filter = arg
-			filterSet = true
-		} else if !strings.HasPrefix(arg, "-") && filterSet && inputFile == "" {
-			inputFile = arg
-		}
-	}
+	filter := opts.filter
+	outputFormat := opts.outputFormat
+	inputFile := opts.inputFile
 
 	// Auto-detect color support if not explicitly set
-	if !colorOutput && os.Getenv("NO_COLOR") == "" {
+	colorOutput := opts.color
+	if !opts.colorSet && os.Getenv("NO_COLOR") == "" {
 		// Check if output is a terminal
-		if fileInfo, _ := os.Stdout.Stat(); (fileInfo.Mode() & os.ModeCharDevice) != 0 {
+		if fileInfo, _ := os.Stdout.Stat(); opts.outputFile == "" && (fileInfo.Mode()&os.ModeCharDevice) != 0 {
 			colorOutput = true
 		}
 	}
 
-	// Read input
-	var input []byte
-	var err error
-
-	if inputFile != "" {
-		input, err = os.ReadFile(inputFile)
+	useColor := colorOutput && !opts.stats && !opts.raw && (outputFormat == "json" || outputFormat == "compact")
+	var jqArgs []string
+	if opts.nullInput {
+		jqArgs = append(jqArgs, "-n")
+	}
+	if opts.slurp {
+		jqArgs = append(jqArgs, "-s")
+	}
+	if opts.unbuffered {
+		jqArgs = append(jqArgs, "--unbuffered")
+	}
+	out := &resultWriter{w: bufio.NewWriter(os.Stdout), format: outputFormat, opts: opts}
+	if opts.outputFile != "" {
+		out.w = &outputFile{name: opts.outputFile}
+	}
+	if opts.stats || opts.maxTokens > 0 || opts.optimize != "" {
+		tok, err := tokenizer.Get(opts.tokenizer)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading file '%s': %v\n", inputFile, err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "Error loading tokenizer: %v\n", err)
+			os.Exit(2)
 		}
-	} else {
-		// Check if stdin is piped
-		stat, _ := os.Stdin.Stat()
-		if (stat.Mode() & os.ModeCharDevice) != 0 {
+		out.tokenizer = tok
+	}
+	if opts.explain {
+		out.explain = os.Stderr
+	}
+	if opts.chunk {
+		source := inputFile
+		if source == "" {
+			source = "-"
+		}
+		out.chunks = &chunker{w: out.w, budget: opts.maxTokens, tok: out.tokenizer, source: source, dir: opts.outDir, warn: os.Stderr}
+	}
+	if opts.conform {
+		template, err := loadTemplate(opts.template, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading template '%s': %v\n", opts.template, err)
+			os.Exit(2)
+		}
+		out.conformance = &conformer{w: out.w, template: template}
+		defer func() {
+			// Runs once the results are written; failures exit earlier
+			if n := out.conformance.mismatches; n == 1 {
+				fmt.Fprintf(os.Stderr, "1 mismatch with template '%s'\n", opts.template)
+				os.Exit(1)
+			} else if n > 1 {
+				fmt.Fprintf(os.Stderr, "%d mismatches with template '%s'\n", n, opts.template)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Open input
+	in, err := openInput(inputFile)
+	if err != nil {
+		if err == errNoInput {
 			// No piped input and no file specified
 			fmt.Fprintf(os.Stderr, "Error: No input provided\n")
 			fmt.Fprintf(os.Stderr, "Usage: tq [filter] [file] or cat file | tq [filter]\n")
 			fmt.Fprintf(os.Stderr, "Try 'tq --help' for more information\n")
-			os.Exit(1)
+		} else if inputFile != "" {
+			fmt.Fprintf(os.Stderr, "Error reading file '%s': %v\n", inputFile, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
 		}
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	// Pick the input format from the file extension or the first bytes
+	reader := bufio.NewReader(in)
+	inputFormat := opts.inputFormat
+	if opts.follow {
+		// Peeking at the input to detect its format would wait for it
+		inputFormat = "toon"
+	} else if inputFormat == "auto" {
+		head, _ := reader.Peek(512)
+		inputFormat = detectInputFormat(inputFile, head)
+	}
+	if opts.inPlace && inputFormat != "toon" {
+		fmt.Fprintf(os.Stderr, "Error: --in-place only supports TOON input\n")
+		os.Exit(2)
+	}
+	if opts.recover && opts.extract == "" && inputFormat != "toon" {
+		fmt.Fprintf(os.Stderr, "Error: --recover only supports TOON input\n")
+		os.Exit(2)
+	}
 
-		input, err = io.ReadAll(os.Stdin)
+	if opts.stream || opts.follow {
+		var decodeErr error
+		var err error
+		if opts.follow {
+			// Feed each field and row to jq as soon as its line is complete
+			err = runJQ(filter, useColor, jqArgs, func(w io.Writer) error {
+				decodeErr = writePartialValues(reader, w)
+				return decodeErr
+			}, out.write)
+		} else if inputFormat == "toon" {
+			// Decode incrementally and feed [path, leaf] events to jq as they are read
+			err = runJQ(filter, useColor, jqArgs, func(w io.Writer) error {
+				decodeErr = writeStreamEvents(reader, w)
+				return decodeErr
+			}, out.write)
+		} else {
+			// jq streams JSON natively; other formats are converted to JSON first
+			err = runJQ(filter, useColor, append(jqArgs, "--stream"), func(w io.Writer) error {
+				decodeErr = writeJSONStream(inputFormat, reader, w, opts)
+				return decodeErr
+			}, out.write)
+		}
+		closeErr := out.close()
+		if decodeErr != nil {
+			printParseError(inputFormat, decodeErr)
+			os.Exit(1)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			reportRunError(filter, err)
 			os.Exit(1)
 		}
+		if closeErr != nil {
+			reportWriteError(opts.outputFile, closeErr)
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Convert TOON to JSON using Node.js script
-	jsonData, err := toonToJSON(string(input))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing TOON:\n")
-		fmt.Fprintf(os.Stderr, "  %v\n", err)
-		fmt.Fprintf(os.Stderr, "\nPlease check your TOON syntax:\n")
-		fmt.Fprintf(os.Stderr, "  - Verify proper indentation (2 spaces)\n")
-		fmt.Fprintf(os.Stderr, "  - Check array declarations: arrayName[N]{fields}:\n")
-		fmt.Fprintf(os.Stderr, "  - Ensure keys are followed by colons\n")
-		os.Exit(1)
-	}
-
-	// Apply jq filter
-	useColor := colorOutput && (outputFormat == "json" || outputFormat == "compact")
-	result, err := applyJQ(jsonData, filter, useColor)
+	input, err := io.ReadAll(reader)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error applying filter '%s':\n", filter)
-		fmt.Fprintf(os.Stderr, "  %v\n", err)
-		fmt.Fprintf(os.Stderr, "\nFilter syntax reference:\n")
-		fmt.Fprintf(os.Stderr, "  .field          - Extract field\n")
-		fmt.Fprintf(os.Stderr, "  .[0]            - Get array element\n")
-		fmt.Fprintf(os.Stderr, "  .[]             - Iterate array\n")
-		fmt.Fprintf(os.Stderr, "  select(expr)    - Filter by condition\n")
-		fmt.Fprintf(os.Stderr, "\nSee 'tq --help' for more examples\n")
+		if inputFile != "" {
+			fmt.Fprintf(os.Stderr, "Error reading file '%s': %v\n", inputFile, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+		}
 		os.Exit(1)
 	}
 
-	// Output result based on format
-	switch outputFormat {
-	case "json":
-		// Pretty-print JSON
-		prettyJSON, err := formatJSON(result, true)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error formatting JSON: %v\n", err)
+	if opts.extract != "" {
+		// Filter each code block of the Markdown input as its own document
+		blocks := extractCodeBlocks(input, strings.Split(opts.fenceLangs, ","))
+		if len(blocks) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no %s code blocks found in the input\n", strings.ReplaceAll(opts.fenceLangs, ",", ", "))
 			os.Exit(1)
 		}
-		fmt.Print(prettyJSON)
-
-	case "compact":
-		// Compact JSON (single line)
-		fmt.Print(result)
-
-	case "raw":
-		// Raw values without quotes (useful for strings)
-		lines := strings.Split(strings.TrimSpace(result), "\n")
-		for _, line := range lines {
-			if line == "" {
-				continue
-			}
-			// Try to parse as JSON and extract raw value
-			var v interface{}
-			if err := json.Unmarshal([]byte(line), &v); err == nil {
-				if str, ok := v.(string); ok {
-					fmt.Println(str)
-				} else {
-					fmt.Println(line)
-				}
+		for _, b := range blocks {
+			format := fenceFormats[b.lang]
+			var jsonData string
+			if opts.recover && format == "toon" {
+				jsonData, err = recoverValues([]byte(b.text), b.startLine, os.Stderr)
 			} else {
-				fmt.Println(line)
+				jsonData, err = decodeInput(format, []byte(b.text), opts)
 			}
-		}
-
-	default: // "toon"
-		// Handle multiple JSON values (jq can output multiple values)
-		lines := strings.Split(strings.TrimSpace(result), "\n")
-		for i, line := range lines {
-			if line == "" {
-				continue
-			}
-			// Convert each JSON line back to TOON
-			toonOutput, err := jsonToTOON(line)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error converting to TOON: %v\n", err)
+				out.close()
+				fmt.Fprintf(os.Stderr, "In code block %d (%s, lines %d-%d):\n", b.index, b.lang, b.startLine, b.endLine)
+				printParseError(format, err)
 				os.Exit(1)
 			}
-			fmt.Print(toonOutput)
-			// Add separator between multiple results
-			if i < len(lines)-1 && lines[i+1] != "" {
-				fmt.Println("---")
+			meta, err := b.meta()
+			if err == nil {
+				err = runJQ(filter, useColor, append(jqArgs, "--argjson", "fence", meta), func(w io.Writer) error {
+					_, err := io.WriteString(w, jsonData)
+					return err
+				}, out.write)
+			}
+			if err != nil {
+				out.close()
+				reportRunError(filter, err)
+				os.Exit(1)
 			}
 		}
+		if err := out.close(); err != nil {
+			reportWriteError(opts.outputFile, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Convert the input to JSON
+	var jsonData string
+	if opts.recover {
+		jsonData, err = recoverValues(input, 1, os.Stderr)
+	} else {
+		jsonData, err = decodeInput(inputFormat, input, opts)
+	}
+	if err != nil {
+		printParseError(inputFormat, err)
+		os.Exit(1)
+	}
+
+	if opts.inPlace {
+		// Apply jq filter and collect its single result
+		result, err := applyJQ(jsonData, filter, useColor, jqArgs...)
+		if err != nil {
+			printFilterError(filter, err)
+			os.Exit(1)
+		}
+		if err := editInPlace(inputFile, result, opts.backup); err != nil {
+			fmt.Fprintf(os.Stderr, "Error editing '%s' in place: %v\n", inputFile, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Apply jq filter, writing each result as soon as jq produces it
+	err = runJQ(filter, useColor, jqArgs, func(w io.Writer) error {
+		_, err := io.WriteString(w, jsonData)
+		return err
+	}, out.write)
+	closeErr := out.close()
+	if err != nil {
+		reportRunError(filter, err)
+		os.Exit(1)
+	}
+	if closeErr != nil {
+		reportWriteError(opts.outputFile, closeErr)
+		os.Exit(1)
+	}
+}
+
+// reportWriteError prints a failure to write the output file or stdout.
+func reportWriteError(outputFile string, err error) {
+	if outputFile != "" {
+		fmt.Fprintf(os.Stderr, "Error writing '%s': %v\n", outputFile, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+}
+
+// reportRunError prints an error from runJQ, which is either a problem
+// with the filter or a result that could not be written in the selected
+// output format.
+func reportRunError(filter string, err error) {
+	var outErr *outputError
+	if errors.As(err, &outErr) {
+		fmt.Fprintf(os.Stderr, "Error %v\n", outErr.err)
+		return
+	}
+	printFilterError(filter, err)
+}
+
+// errNoInput is returned by openInput when no file is given and stdin is a
+// terminal.
+var errNoInput = errors.New("no input provided")
+
+// openInput opens the named file, or stdin when inputFile is empty or "-".
+func openInput(inputFile string) (io.ReadCloser, error) {
+	if inputFile != "" && inputFile != "-" {
+		return os.Open(inputFile)
+	}
+	// Check if stdin is piped
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if (stat.Mode() & os.ModeCharDevice) != 0 {
+		return nil, errNoInput
+	}
+	return io.NopCloser(os.Stdin), nil
+}
+
+func printParseError(format string, err error) {
+	if format != "toon" {
+		fmt.Fprintf(os.Stderr, "Error parsing %s input:\n", strings.ToUpper(format))
+		fmt.Fprintf(os.Stderr, "  %v\n", err)
+		return
 	}
+	fmt.Fprintf(os.Stderr, "Error parsing TOON:\n")
+	fmt.Fprintf(os.Stderr, "  %v\n", err)
+	fmt.Fprintf(os.Stderr, "\nPlease check your TOON syntax:\n")
+	fmt.Fprintf(os.Stderr, "  - Verify proper indentation (2 spaces)\n")
+	fmt.Fprintf(os.Stderr, "  - Check array declarations: arrayName[N]{fields}:\n")
+	fmt.Fprintf(os.Stderr, "  - Ensure keys are followed by colons\n")
+}
+
+func printFilterError(filter string, err error) {
+	fmt.Fprintf(os.Stderr, "Error applying filter '%s':\n", filter)
+	fmt.Fprintf(os.Stderr, "  %v\n", err)
+	fmt.Fprintf(os.Stderr, "\nFilter syntax reference:\n")
+	fmt.Fprintf(os.Stderr, "  .field          - Extract field\n")
+	fmt.Fprintf(os.Stderr, "  .[0]            - Get array element\n")
+	fmt.Fprintf(os.Stderr, "  .[]             - Iterate array\n")
+	fmt.Fprintf(os.Stderr, "  select(expr)    - Filter by condition\n")
+	fmt.Fprintf(os.Stderr, "\nSee 'tq --help' for more examples\n")
 }
 
 func formatJSON(compactJSON string, pretty bool) (string, error) {
@@ -234,33 +395,21 @@ func toonToJSON(toonInput string) (string, error) {
 	return out.String(), nil
 }
 
-func applyJQ(jsonInput, filter string, color bool) (string, error) {
-	// Check if jq is installed
-	if _, err := exec.LookPath("jq"); err != nil {
-		return "", fmt.Errorf("jq is not installed. Please install jq to use tq")
-	}
-
-	// Build jq arguments
-	args := []string{"-c"}
-	if color {
-		args = append(args, "-C") // Color output
-	} else {
-		args = append(args, "-M") // Monochrome output
-	}
-	args = append(args, filter)
-
-	cmd := exec.Command("jq", args...)
-	cmd.Stdin = strings.NewReader(jsonInput)
-
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("%v: %s", err, stderr.String())
+// applyJQ runs jq with filter over jsonInput and returns all of its output
+// at once. Use runJQ to process results as they are produced.
+func applyJQ(jsonInput, filter string, color bool, extraArgs ...string) (string, error) {
+	var out strings.Builder
+	err := runJQ(filter, color, extraArgs, func(w io.Writer) error {
+		_, err := io.WriteString(w, jsonInput)
+		return err
+	}, func(line string) error {
+		out.WriteString(line)
+		out.WriteByte('\n')
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
-
 	return out.String(), nil
 }
 
@@ -337,27 +486,16 @@ func findScript(scriptName string) string {
 }
 
 func printHelp() {
-	fmt.Println(`tq - TOON query processor (like jq for TOON format)
+	fmt.Printf(`tq - TOON query processor (like jq for TOON format)
 
 Usage:
   tq [options] [filter] [file]
   tq [options] [filter] < file
   cat file | tq [options] [filter]
+  tq chunk --max-tokens N [options] [filter] [file]
+  tq conform --template FILE [options] [[filter] file]
 
-Options:
-  Output formats:
-    --json         Output as pretty-printed JSON
-    -c, --compact  Output as compact JSON (single line)
-    -r, --raw      Output raw values (strings without quotes)
-    (default)      Output as TOON format
-
-  Display:
-    -C, --color    Force colored output
-    -M, --no-color Force monochrome output
-
-  Help:
-    -h, --help     Show this help message
-    -v, --version  Show version
+%s
 
 Filter Syntax (jq-compatible):
   .              Identity (return input as-is)
@@ -389,5 +527,50 @@ Examples:
   tq '.users[] | {name, email}' data.toon               # Extract specific fields
   tq '.users | map({name, older: (.age + 1)})' data.toon # Transform data
 
-For more information, visit: https://github.com/RHEMS-japan/tq`)
+  # 5. Other input formats
+  curl -s https://api.example.com/users | tq '.'       # JSON in, TOON out
+  tq -c 'select(.level == "error")' app.jsonl            # One record at a time
+  tq -I yaml -o toon '.spec' deploy.yaml                 # YAML in, TOON out
+  tq -I json5 '.compilerOptions' tsconfig.json           # JSON with comments and trailing commas
+  tq -o toon '.' Cargo.toml                              # TOML in, TOON out
+  tq '.feed.item' partner.xml                            # Repeated XML records as a tabular array
+  tq '.' message.msgpack                                 # Inspect a MessagePack payload
+  tq -o markdown '.employees' data.toon                  # Table for a PR description
+  tq -o xlsx -o report.xlsx '.' data.toon                # One sheet per tabular array
+  tq -o sql --sql-dialect sqlite . company.toon          # CREATE TABLE and INSERTs per tabular array
+  tq -o dotenv '.services.api' config.toon > .env        # DATABASE_URL=... from nested keys
+  tq -I logfmt -s 'map(select(.level=="error"))' app.log # Error lines as a tabular array
+  llm-cli ask ... | tq --extract fenced '.items[]'       # Query the toon blocks of a Markdown reply
+  tq --extract fenced --fence-lang toon,json '{i: $fence.index, n: length}' reply.md
+  tq --recover '.users' truncated.toon 2> repairs.ndjson   # Partial result from cut-off output
+  tq '.' export.csv                                      # CSV to a TOON tabular array
+  tq -o csv '.employees' data.toon                       # Tabular array to CSV
+  tq -o ndjson --unbuffered '.employees' data.toon       # One row per line, flushed immediately
+
+  # 6. In-place editing
+  tq -i '.version = "1.2"' config.toon
+  tq -i --backup=.bak 'del(.debug)' config.toon
+
+  # 7. Streaming large files
+  tq -c --stream 'select(.[0][0] == "users")' data.toon
+  tq -n --stream 'fromstream(1 | truncate_stream(inputs | select(.[0][0] == "users")))' data.toon
+  llm-cli ask ... | tq -c --follow-partial 'select(.[0][0] == "results") | .[1]'   # Rows while they are generated
+
+  # 8. Token counts
+  tq --stats '.' data.toon                               # Tokens as TOON, JSON and pretty JSON, by key
+  tq --stats --tokenizer o200k_base.tiktoken '.' data.toon # Exact counts with a model's vocabulary
+  tq --max-tokens 2000 '.' data.toon                     # Trim rows and long strings to fit a prompt
+  tq --optimize tokens --explain '.' data.toon           # Cheapest layout and delimiter per array
+  tq -o prompt --primer --max-tokens 2000 '.' data.toon  # Labeled toon code block for a prompt
+  tq chunk --max-tokens 512 '.' data.toon                # Self-contained chunks as NDJSON records
+  tq chunk --max-tokens 512 --out-dir chunks '.' data.toon # chunks/chunk-0001.toon, ...
+
+  # 9. Validating model output
+  tq conform --template expected.toon reply.toon         # Path-level mismatches, exit status 1
+  tq conform --recover --template expected.toon '.data' reply.toon
+
+Use '--' to end option processing, e.g. tq -- '-.value' data.toon
+
+For more information, visit: https://github.com/RHEMS-japan/tq
+`, tqOptions.help())
 }
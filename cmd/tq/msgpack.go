@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// maxBinaryDepth bounds nesting so that hostile input fails cleanly.
+const maxBinaryDepth = 1000
+
+// binaryReader reads a binary encoding from a byte slice, reporting
+// offsets in errors.
+type binaryReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *binaryReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, fmt.Errorf("offset %d: unexpected end of data", r.pos)
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *binaryReader) uint(size int) (uint64, error) {
+	b, err := r.next(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// binaryValues decodes every value in data with decode, returning them as
+// JSON values, one per line. Captured queue messages are often several
+// values back to back, and each becomes a separate input.
+//
+// MessagePack and CBOR values that JSON has no type for are represented
+// by small tagged objects, which --output msgpack and --output cbor turn
+// back into the original types:
+//
+//	byte string             {"$bytes": "<base64>"}
+//	MessagePack extension   {"$ext": <type>, "data": "<base64>"}
+//	CBOR tag                {"$tag": <number>, "value": <value>}
+//	CBOR simple value       {"$simple": <number>}
+//
+// Base64 uses the standard alphabet with padding. Map keys that are not
+// strings become their JSON text (1, true, ...), infinities and NaN become
+// null, and CBOR's undefined becomes null.
+func binaryValues(data []byte, decode func(*binaryReader) (interface{}, error)) (string, error) {
+	r := &binaryReader{data: data}
+	var out strings.Builder
+	for r.pos < len(r.data) {
+		v, err := decode(r)
+		if err != nil {
+			return "", err
+		}
+		s, err := compactJSON(v)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(s)
+		out.WriteByte('\n')
+	}
+	return out.String(), nil
+}
+
+// msgpackValues converts a sequence of MessagePack values to JSON.
+func msgpackValues(data []byte) (string, error) {
+	return binaryValues(data, func(r *binaryReader) (interface{}, error) {
+		return readMsgpack(r, 0)
+	})
+}
+
+func readMsgpack(r *binaryReader, depth int) (interface{}, error) {
+	if depth > maxBinaryDepth {
+		return nil, fmt.Errorf("offset %d: data nested too deeply", r.pos)
+	}
+	start := r.pos
+	b, err := r.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	c := byte(b)
+
+	switch {
+	case c <= 0x7f:
+		return json.Number(strconv.FormatUint(b, 10)), nil
+	case c >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(c)))), nil
+	case c >= 0x80 && c <= 0x8f:
+		return readMsgpackMap(r, uint64(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return readMsgpackArray(r, uint64(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		s, err := r.next(uint64(c & 0x1f))
+		return string(s), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6: // bin 8/16/32
+		n, err := r.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return bytesValue(data), nil
+	case 0xc7, 0xc8, 0xc9: // ext 8/16/32
+		n, err := r.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackExt(r, n)
+	case 0xca:
+		n, err := r.uint(4)
+		return floatValue(float64(math.Float32frombits(uint32(n))), 32), err
+	case 0xcb:
+		n, err := r.uint(8)
+		return floatValue(math.Float64frombits(n), 64), err
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8/16/32/64
+		n, err := r.uint(1 << (c - 0xcc))
+		return json.Number(strconv.FormatUint(n, 10)), err
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8/16/32/64
+		size := 1 << (c - 0xd0)
+		n, err := r.uint(size)
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return json.Number(strconv.FormatInt(int64(n<<shift)>>shift, 10)), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext 1/2/4/8/16
+		return readMsgpackExt(r, 1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb: // str 8/16/32
+		n, err := r.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		s, err := r.next(n)
+		return string(s), err
+	case 0xdc, 0xdd: // array 16/32
+		n, err := r.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n, depth)
+	case 0xde, 0xdf: // map 16/32
+		n, err := r.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n, depth)
+	}
+	return nil, fmt.Errorf("offset %d: invalid MessagePack type byte 0x%02x", start, c)
+}
+
+func readMsgpackArray(r *binaryReader, n uint64, depth int) (interface{}, error) {
+	// Every element takes at least one byte
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, fmt.Errorf("offset %d: unexpected end of data", r.pos)
+	}
+	arr := make([]interface{}, n)
+	for i := range arr {
+		v, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+func readMsgpackMap(r *binaryReader, n uint64, depth int) (interface{}, error) {
+	obj := toon.NewObject()
+	for i := uint64(0); i < n; i++ {
+		k, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		key, err := binaryKey(k)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(key, v)
+	}
+	return obj, nil
+}
+
+func readMsgpackExt(r *binaryReader, n uint64) (interface{}, error) {
+	t, err := r.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	ext := toon.NewObject()
+	ext.Set("$ext", json.Number(strconv.Itoa(int(int8(t)))))
+	ext.Set("data", base64.StdEncoding.EncodeToString(data))
+	return ext, nil
+}
+
+// bytesValue represents a byte string as a tagged base64 string.
+func bytesValue(data []byte) *toon.Object {
+	obj := toon.NewObject()
+	obj.Set("$bytes", base64.StdEncoding.EncodeToString(data))
+	return obj
+}
+
+// floatValue formats a float with the precision it was encoded with.
+// JSON cannot represent infinities and NaN, so they become null.
+func floatValue(f float64, bits int) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, bits))
+}
+
+// binaryKey converts a decoded map key to an object key. Keys that are not
+// strings are written as their JSON text.
+func binaryKey(k interface{}) (string, error) {
+	if s, ok := k.(string); ok {
+		return s, nil
+	}
+	return compactJSON(k)
+}
+
+// toMsgpack encodes one JSON value as MessagePack.
+func toMsgpack(jsonInput string) ([]byte, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return appendMsgpack(nil, v)
+}
+
+func appendMsgpack(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case json.Number:
+		return appendMsgpackNumber(b, v)
+	case string:
+		return append(appendMsgpackLength(b, len(v), 0xa0, 31, 0xd9, 0xda, 0xdb), v...), nil
+	case []interface{}:
+		b = appendMsgpackLength(b, len(v), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			var err error
+			if b, err = appendMsgpack(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	obj := v.(*toon.Object)
+	if data, ok, err := taggedBytes(obj); ok {
+		if err != nil {
+			return nil, err
+		}
+		b = appendMsgpackLength(b, len(data), 0, -1, 0xc4, 0xc5, 0xc6)
+		return append(b, data...), nil
+	}
+	if ext, data, ok, err := taggedExt(obj); ok {
+		if err != nil {
+			return nil, err
+		}
+		switch len(data) {
+		case 1:
+			b = append(b, 0xd4)
+		case 2:
+			b = append(b, 0xd5)
+		case 4:
+			b = append(b, 0xd6)
+		case 8:
+			b = append(b, 0xd7)
+		case 16:
+			b = append(b, 0xd8)
+		default:
+			b = appendMsgpackLength(b, len(data), 0, -1, 0xc7, 0xc8, 0xc9)
+		}
+		return append(append(b, byte(ext)), data...), nil
+	}
+	b = appendMsgpackLength(b, obj.Len(), 0x80, 15, 0, 0xde, 0xdf)
+	for _, k := range obj.Keys() {
+		val, _ := obj.Get(k)
+		b = append(appendMsgpackLength(b, len(k), 0xa0, 31, 0xd9, 0xda, 0xdb), k...)
+		var err error
+		if b, err = appendMsgpack(b, val); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendMsgpackLength writes the type byte and length of a string,
+// binary, array or map. Lengths up to fixMax use the fix form fix+n; longer
+// ones use op8, op16 or op32, where 0 marks a form the type does not have.
+func appendMsgpackLength(b []byte, n int, fix byte, fixMax int, op8, op16, op32 byte) []byte {
+	switch {
+	case n <= fixMax:
+		return append(b, fix+byte(n))
+	case op8 != 0 && n <= math.MaxUint8:
+		return append(b, op8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, op16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, op32), uint32(n))
+}
+
+func appendMsgpackNumber(b []byte, n json.Number) ([]byte, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		switch {
+		case i >= 0 && i <= 0x7f, i < 0 && i >= -32:
+			return append(b, byte(i)), nil
+		case i >= math.MinInt8 && i <= math.MaxUint8:
+			if i < 0 {
+				return append(b, 0xd0, byte(i)), nil
+			}
+			return append(b, 0xcc, byte(i)), nil
+		case i >= math.MinInt16 && i <= math.MaxUint16:
+			if i < 0 {
+				return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i)), nil
+			}
+			return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(i)), nil
+		case i >= math.MinInt32 && i <= math.MaxUint32:
+			if i < 0 {
+				return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i)), nil
+			}
+			return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(i)), nil
+		case i < 0:
+			return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), uint64(i)), nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u), nil
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return nil, fmt.Errorf("number %s is out of range", n)
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f)), nil
+}
+
+// taggedBytes recognizes {"$bytes": "<base64>"}.
+func taggedBytes(obj *toon.Object) ([]byte, bool, error) {
+	v, ok := obj.Get("$bytes")
+	if !ok || obj.Len() != 1 {
+		return nil, false, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, true, fmt.Errorf("$bytes must be a base64 string")
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, true, fmt.Errorf("$bytes: %v", err)
+	}
+	return data, true, nil
+}
+
+// taggedExt recognizes {"$ext": <type>, "data": "<base64>"}.
+func taggedExt(obj *toon.Object) (int8, []byte, bool, error) {
+	t, ok := obj.Get("$ext")
+	d, hasData := obj.Get("data")
+	if !ok || !hasData || obj.Len() != 2 {
+		return 0, nil, false, nil
+	}
+	n, err := strconv.ParseInt(fmt.Sprint(t), 10, 8)
+	if _, isNumber := t.(json.Number); !isNumber || err != nil {
+		return 0, nil, true, fmt.Errorf("$ext must be an integer from -128 to 127")
+	}
+	s, ok := d.(string)
+	if !ok {
+		return 0, nil, true, fmt.Errorf("$ext data must be a base64 string")
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return 0, nil, true, fmt.Errorf("$ext data: %v", err)
+	}
+	return int8(n), data, true, nil
+}
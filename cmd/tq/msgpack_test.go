@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestMsgpackValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string // hex
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "map keeps key order",
+			input: "82a17a01a16102",
+			want:  "{\"z\":1,\"a\":2}\n",
+		},
+		{
+			name:  "integers and floats",
+			input: "97" + "7f" + "e0" + "cc80" + "d0ff" + "cfffffffffffffffff" + "ca3fc00000" + "cb7ff0000000000000",
+			want:  "[127,-32,128,-1,18446744073709551615,1.5,null]\n",
+		},
+		{
+			name:  "binary, extension and non-string keys",
+			input: "83a362696ec403010203" + "01c0" + "a165d5056162",
+			want:  "{\"bin\":{\"$bytes\":\"AQID\"},\"1\":null,\"e\":{\"$ext\":5,\"data\":\"YWI=\"}}\n",
+		},
+		{
+			name:  "concatenated values",
+			input: "01a178c3",
+			want:  "1\n\"x\"\ntrue\n",
+		},
+		{
+			name:    "truncated data",
+			input:   "92a3616263",
+			wantErr: true,
+		},
+		{
+			name:    "never-used type byte",
+			input:   "c1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.input)
+			got, err := msgpackValues(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("msgpackValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("msgpackValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToMsgpack(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string // hex
+		wantErr bool
+	}{
+		{
+			name:  "integers use the smallest form",
+			input: `[0,127,128,-32,-33,65536,-2147483649,18446744073709551615]`,
+			want:  "98" + "00" + "7f" + "cc80" + "e0" + "d0df" + "ce00010000" + "d3ffffffff7fffffff" + "cfffffffffffffffff",
+		},
+		{
+			name:  "floats, strings and literals",
+			input: `{"f":1.5,"s":"héllo","n":null,"b":false}`,
+			want:  "84a166cb3ff8000000000000a173a668c3a96c6c6fa16ec0a162c2",
+		},
+		{
+			name:  "tagged bytes and extension",
+			input: `[{"$bytes":"AQID"},{"$ext":-1,"data":"AAAAAA=="},{"$ext":1,"data":"YWJj"}]`,
+			want:  "93c403010203d6ff00000000c70301616263",
+		},
+		{
+			name:  "long string",
+			input: `"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`,
+			want:  "d921616161616161616161616161616161616161616161616161616161616161616161",
+		},
+		{
+			name:    "invalid base64",
+			input:   `{"$bytes":"!!"}`,
+			wantErr: true,
+		},
+		{
+			name:    "extension type out of range",
+			input:   `{"$ext":200,"data":""}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toMsgpack(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toMsgpack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && hex.EncodeToString(got) != tt.want {
+				t.Errorf("toMsgpack() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// optimizeModes lists the values accepted by --optimize.
+var optimizeModes = []string{"tokens"}
+
+// delimiterNames names the delimiters --optimize tries, in order.
+var delimiterNames = []struct {
+	delim byte
+	name  string
+}{{',', "comma"}, {'\t', "tab"}, {'|', "pipe"}}
+
+// encodedTOON is one result rendered by encodeTOON, with the value and
+// the options it was written with.
+type encodedTOON struct {
+	text     string
+	value    interface{}
+	maxItems int // elements kept of each array, or 0 if none were trimmed
+	arrays   map[string]toon.ArrayStyle
+}
+
+// encodeTOON renders one result with the native encoder, for
+// --optimize and --max-tokens.
+func (rw *resultWriter) encodeTOON(line string) (*encodedTOON, error) {
+	v, err := toon.DecodeJSON([]byte(line))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	enc := &encodedTOON{value: v}
+	if rw.opts.optimize != "" {
+		if enc.arrays, err = optimizeArrays(v, rw.tokenizer, rw.explain); err != nil {
+			return nil, fmt.Errorf("optimizing TOON: %v", err)
+		}
+	}
+	if rw.opts.maxTokens > 0 {
+		if enc.text, enc.maxItems, err = fitTokens(v, rw.opts.maxTokens, rw.tokenizer, enc.arrays); err != nil {
+			return nil, fmt.Errorf("fitting the token budget: %v", err)
+		}
+		return enc, nil
+	}
+	if enc.text, err = toon.Encode(v, &toon.EncodeOptions{Arrays: enc.arrays}); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// arrayPath collects what the arrays at one path allow.
+type arrayPath struct {
+	path             string
+	tabular, inlined bool
+}
+
+// optimizeArrays chooses a layout and delimiter for the arrays at each
+// path, in document order. For every path it encodes the whole document
+// with each layout the arrays allow and each delimiter, keeping the
+// choices already made for earlier paths, and keeps the candidate with
+// the fewest tokens; ties go to the earlier candidate. A candidate only
+// counts if its output decodes to the same value as the default encoding.
+// With explain set, the candidates and the choice for each path are
+// written to it.
+func optimizeArrays(v interface{}, tok tokenizer.Tokenizer, explain io.Writer) (map[string]toon.ArrayStyle, error) {
+	var paths []*arrayPath
+	byPath := make(map[string]*arrayPath)
+	toon.WalkArrays(v, func(path string, arr []interface{}) {
+		if len(arr) == 0 {
+			return
+		}
+		p := byPath[path]
+		if p == nil {
+			p = &arrayPath{path: path}
+			byPath[path] = p
+			paths = append(paths, p)
+		}
+		p.tabular = p.tabular || toon.TabularFields(arr) != nil
+		p.inlined = p.inlined || toon.Primitives(arr)
+	})
+
+	plain, err := toon.Encode(v, nil)
+	if err != nil {
+		return nil, err
+	}
+	want, err := decodedJSON(plain)
+	if err != nil {
+		return nil, fmt.Errorf("the default encoding does not decode: %v", err)
+	}
+
+	arrays := make(map[string]toon.ArrayStyle)
+	best := tok.Count(plain)
+	for _, p := range paths {
+		layouts := []toon.Layout{toon.List}
+		if p.inlined {
+			layouts = append([]toon.Layout{toon.Inline}, layouts...)
+		}
+		if p.tabular {
+			layouts = append([]toon.Layout{toon.Tabular}, layouts...)
+		}
+
+		before := best
+		chosen, found := toon.ArrayStyle{}, false
+		var notes []string
+		for _, layout := range layouts {
+			for _, d := range delimiterNames {
+				style := toon.ArrayStyle{Layout: layout, Delimiter: d.delim}
+				arrays[p.path] = style
+				s, err := toon.Encode(v, &toon.EncodeOptions{Arrays: arrays})
+				if err != nil {
+					return nil, err
+				}
+				n := tok.Count(s)
+				note := fmt.Sprintf("  %-8s %-6s %s", layout, d.name, toon.Thousands(n))
+				if got, err := decodedJSON(s); err != nil || got != want {
+					note = fmt.Sprintf("  %-8s %-6s does not decode to the same value", layout, d.name)
+				} else if !found || n < best {
+					chosen, found, best = style, true, n
+				}
+				notes = append(notes, note)
+			}
+		}
+		if !found {
+			// Nothing round-trips; keep the default for this path
+			delete(arrays, p.path)
+			best = before
+		} else {
+			arrays[p.path] = chosen
+		}
+
+		if explain != nil {
+			if found {
+				fmt.Fprintf(explain, "%s: %s, %s delimiter (%s → %s tokens)\n", p.path, chosen.Layout, delimiterName(chosen.Delimiter), toon.Thousands(before), toon.Thousands(best))
+			} else {
+				fmt.Fprintf(explain, "%s: default layout, no candidate decodes to the same value\n", p.path)
+			}
+			for _, note := range notes {
+				fmt.Fprintln(explain, note)
+			}
+			if !p.inlined {
+				fmt.Fprintf(explain, "  %-8s not all elements are primitives\n", toon.Inline)
+			}
+			if !p.tabular {
+				fmt.Fprintf(explain, "  %-8s not objects with the same primitive fields\n", toon.Tabular)
+			}
+		}
+	}
+	return arrays, nil
+}
+
+// decodedJSON decodes TOON text and returns it as compact JSON, for
+// comparing what two encodings mean.
+func decodedJSON(s string) (string, error) {
+	v, err := toon.Decode([]byte(s))
+	if err != nil {
+		return "", err
+	}
+	return compactJSON(v)
+}
+
+func delimiterName(d byte) string {
+	for _, n := range delimiterNames {
+		if n.delim == d {
+			return n.name
+		}
+	}
+	return string(d)
+}
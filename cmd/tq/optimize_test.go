@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+func TestOptimizeArrays(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]toon.ArrayStyle
+	}{
+		{
+			name:  "default layouts are already cheapest",
+			input: `{"users":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"tags":["a","b"],"none":[]}`,
+			want: map[string]toon.ArrayStyle{
+				".users": {Layout: toon.Tabular, Delimiter: ','},
+				".tags":  {Layout: toon.Inline, Delimiter: ','},
+			},
+		},
+		{
+			name:  "pipe avoids quoting values with commas",
+			input: `{"items":[{"name":"Smith, John","city":"Paris, FR"},{"name":"Doe, Jane","city":"Rome, IT"}]}`,
+			want: map[string]toon.ArrayStyle{
+				".items": {Layout: toon.Tabular, Delimiter: '|'},
+			},
+		},
+		{
+			name:  "nested arrays share a path",
+			input: `[{"id":1,"tags":["x"]},{"id":2,"tags":["y","z"]}]`,
+			want: map[string]toon.ArrayStyle{
+				".":        {Layout: toon.List, Delimiter: ','},
+				".[].tags": {Layout: toon.Inline, Delimiter: ','},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := toon.DecodeJSON([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := optimizeArrays(v, tokenizer.Heuristic{}, nil)
+			if err != nil {
+				t.Fatalf("optimizeArrays() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("optimizeArrays() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptimizeExplain(t *testing.T) {
+	v, err := toon.DecodeJSON([]byte(`{"tags":["a,b","c,d"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var explain strings.Builder
+	if _, err := optimizeArrays(v, tokenizer.Heuristic{}, &explain); err != nil {
+		t.Fatal(err)
+	}
+	want := ".tags: inline, pipe delimiter (11 → 8 tokens)\n" +
+		"  inline   comma  11\n" +
+		"  inline   tab    9\n" +
+		"  inline   pipe   8\n" +
+		"  list     comma  16\n" +
+		"  list     tab    14\n" +
+		"  list     pipe   13\n" +
+		"  tabular  not objects with the same primitive fields\n"
+	if explain.String() != want {
+		t.Errorf("explanation =\n%s\nwant\n%s", explain.String(), want)
+	}
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+)
+
+// options holds the settings parsed from the command line.
+type options struct {
+	filter       string
+	inputFile    string
+	inputFormat  string // one of inputFormats
+	outputFormat string // one of outputFormats
+	raw          bool   // print string results without quotes, as jq -r does
+	outputFile   string // write results to this file instead of stdout
+	color        bool
+	colorSet     bool // color was forced on or off explicitly
+	stream       bool
+	follow       bool // --follow-partial
+	nullInput    bool
+	slurp        bool
+	extract      string // one of extractModes, or empty
+	fenceLangs   string // comma-separated code block languages for --extract
+	recover      bool
+	unbuffered   bool
+	inPlace      bool
+	backup       string // suffix for the backup copy made by --in-place
+	csv          csvOptions
+	xmlRoot      string // root element name for --output xml
+	sql          sqlOptions
+	kv           keyValueOptions
+	promptLabel  string // label before the code block of --output prompt
+	primer       bool
+	stats        bool
+	maxTokens    int    // token budget for TOON output, 0 for none
+	optimize     string // one of optimizeModes, or empty
+	explain      bool
+	chunk        bool   // run as `tq chunk`
+	outDir       string // directory for the files written by `tq chunk`
+	tokenizer    string // vocabulary for token counts: a name or a tiktoken file
+	conform      bool   // run as `tq conform`
+	template     string // template file for `tq conform`
+	showHelp     bool
+	showVersion  bool
+}
+
+// option describes a single command-line option. Options with a non-empty
+// arg take a value, given as `--name value`, `--name=value`, `-x value` or
+// `-xvalue`.
+type option struct {
+	short byte
+	long  string
+	arg   string
+	group string
+	help  string
+	set   func(o *options, value string) error
+}
+
+// optionSet is an ordered option table. The order determines how options
+// are listed in the help text.
+type optionSet []option
+
+// tqOptions is the option table for tq.
+var tqOptions = optionSet{
+	{short: 'o', long: "output", arg: "FORMAT|FILE", group: "Output formats", help: "Output format: " + strings.Join(outputFormats, ", ") + " (default: toon), or a file to write to",
+		set: func(o *options, v string) error {
+			if contains(outputFormats, v) {
+				o.outputFormat = v
+				return nil
+			}
+			// Anything that looks like a path is an output file
+			if !strings.ContainsAny(v, "./") {
+				return fmt.Errorf("unknown output format %q (expected one of: %s)", v, strings.Join(outputFormats, ", "))
+			}
+			if o.outputFile != "" {
+				return fmt.Errorf("output file given twice (%s and %s)", o.outputFile, v)
+			}
+			o.outputFile = v
+			return nil
+		}},
+	{long: "json", group: "Output formats", help: "Output as pretty-printed JSON",
+		set: func(o *options, _ string) error { o.outputFormat = "json"; return nil }},
+	{short: 'c', long: "compact", group: "Output formats", help: "Output as compact JSON (single line)",
+		set: func(o *options, _ string) error { o.outputFormat = "compact"; return nil }},
+	{short: 'r', long: "raw", group: "Output formats", help: "Output raw values (strings without quotes), also with -c or --json",
+		set: func(o *options, _ string) error { o.raw = true; return nil }},
+	{long: "unbuffered", group: "Output formats", help: "Flush each result as soon as it is produced",
+		set: func(o *options, _ string) error { o.unbuffered = true; return nil }},
+
+	{short: 'C', long: "color", group: "Display", help: "Force colored output",
+		set: func(o *options, _ string) error { o.color, o.colorSet = true, true; return nil }},
+	{short: 'M', long: "no-color", group: "Display", help: "Force monochrome output",
+		set: func(o *options, _ string) error { o.color, o.colorSet = false, true; return nil }},
+
+	{short: 'I', long: "input-format", arg: "FORMAT", group: "Input", help: "Input format: " + strings.Join(inputFormats, ", ") + " (default: auto)",
+		set: func(o *options, v string) error {
+			if !contains(inputFormats, v) {
+				return fmt.Errorf("unknown input format %q (expected one of: %s)", v, strings.Join(inputFormats, ", "))
+			}
+			o.inputFormat = v
+			return nil
+		}},
+	{long: "extract", arg: "MODE", group: "Input", help: "Read the code blocks of Markdown input as separate documents (MODE: " + strings.Join(extractModes, ", ") + ")",
+		set: func(o *options, v string) error {
+			if !contains(extractModes, v) {
+				return fmt.Errorf("unknown extraction %q (expected one of: %s)", v, strings.Join(extractModes, ", "))
+			}
+			o.extract = v
+			return nil
+		}},
+	{long: "fence-lang", arg: "LANGS", group: "Input", help: "Comma-separated code block languages to extract (default: toon)",
+		set: func(o *options, v string) error {
+			langs := strings.Split(strings.ToLower(v), ",")
+			for i, lang := range langs {
+				langs[i] = strings.TrimSpace(lang)
+				if _, ok := fenceFormats[langs[i]]; !ok {
+					return fmt.Errorf("unknown language %q (expected one of: %s)", langs[i], strings.Join(fenceLangs(), ", "))
+				}
+			}
+			o.fenceLangs = strings.Join(langs, ",")
+			return nil
+		}},
+	{long: "recover", group: "Input", help: "Read as much of malformed or truncated TOON as possible and report each repair on stderr",
+		set: func(o *options, _ string) error { o.recover = true; return nil }},
+	{long: "stream", group: "Input", help: "Parse incrementally and emit [path, leaf] events",
+		set: func(o *options, _ string) error { o.stream = true; return nil }},
+	{long: "follow-partial", group: "Input", help: "Decode TOON as it arrives and emit each field and row as a [path, value] pair once complete",
+		set: func(o *options, _ string) error { o.follow = true; return nil }},
+	{short: 'n', long: "null-input", group: "Input", help: "Use null as input; read events with 'inputs'",
+		set: func(o *options, _ string) error { o.nullInput = true; return nil }},
+	{short: 's', long: "slurp", group: "Input", help: "Read all input values into one array and filter it once",
+		set: func(o *options, _ string) error { o.slurp = true; return nil }},
+
+	{long: "no-header", group: "CSV/TSV", help: "The first row is data, not column names",
+		set: func(o *options, _ string) error { o.csv.noHeader = true; return nil }},
+	{long: "delimiter", arg: "CHAR", group: "CSV/TSV", help: "Field delimiter (default: ',' for CSV, tab for TSV)",
+		set: func(o *options, v string) error {
+			d, err := parseDelimiter(v)
+			o.csv.delimiter = d
+			return err
+		}},
+	{long: "quote", arg: "MODE", group: "CSV/TSV", help: "Quoting: " + strings.Join(csvQuoteModes, ", ") + " (default: auto for CSV, none for TSV)",
+		set: func(o *options, v string) error {
+			if !contains(csvQuoteModes, v) {
+				return fmt.Errorf("unknown quote mode %q (expected one of: %s)", v, strings.Join(csvQuoteModes, ", "))
+			}
+			o.csv.quote = v
+			return nil
+		}},
+	{long: "no-infer", group: "CSV/TSV", help: "Read every cell as a string",
+		set: func(o *options, _ string) error { o.csv.noInfer = true; return nil }},
+	{long: "flatten", group: "CSV/TSV", help: "Write nested values as dotted columns (a.b, tags.0)",
+		set: func(o *options, _ string) error { o.csv.flatten = true; return nil }},
+
+	{long: "xml-root", arg: "NAME", group: "XML", help: "Root element name for XML output (default: root)",
+		set: func(o *options, v string) error {
+			if !xmlNamePattern.MatchString(v) {
+				return fmt.Errorf("%q is not a valid XML element name", v)
+			}
+			o.xmlRoot = v
+			return nil
+		}},
+
+	{long: "sql-dialect", arg: "NAME", group: "SQL", help: "Quoting and column types: " + strings.Join(sqlDialects, ", ") + " (default: postgres)",
+		set: func(o *options, v string) error {
+			if !contains(sqlDialects, v) {
+				return fmt.Errorf("unknown SQL dialect %q (expected one of: %s)", v, strings.Join(sqlDialects, ", "))
+			}
+			o.sql.dialect = v
+			return nil
+		}},
+	{long: "sql-batch", arg: "N", group: "SQL", help: "Rows per INSERT statement (default: " + strconv.Itoa(defaultSQLBatch) + ")",
+		set: func(o *options, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return fmt.Errorf("batch size must be a positive integer, got %q", v)
+			}
+			o.sql.batch = n
+			return nil
+		}},
+
+	{long: "key-separator", arg: "SEP", group: "dotenv/properties/INI", help: "Join nested keys with SEP (default: '_' for dotenv, '.' otherwise)",
+		set: func(o *options, v string) error {
+			if v == "" || strings.ContainsAny(v, "=\n") {
+				return fmt.Errorf("invalid key separator %q", v)
+			}
+			o.kv.separator = v
+			return nil
+		}},
+	{long: "key-case", arg: "CASE", group: "dotenv/properties/INI", help: "Key case: " + strings.Join(keyCases, ", ") + " (default: upper for dotenv, preserve otherwise)",
+		set: func(o *options, v string) error {
+			if !contains(keyCases, v) {
+				return fmt.Errorf("unknown key case %q (expected one of: %s)", v, strings.Join(keyCases, ", "))
+			}
+			o.kv.keyCase = v
+			return nil
+		}},
+
+	{long: "prompt-label", arg: "TEXT", group: "Prompt", help: "Label before the code block of prompt output (default: " + defaultPromptLabel + ")",
+		set: func(o *options, v string) error {
+			if v == "" {
+				return fmt.Errorf("label must not be empty")
+			}
+			o.promptLabel = v
+			return nil
+		}},
+	{long: "primer", group: "Prompt", help: "Explain the TOON format before the code block of prompt output",
+		set: func(o *options, _ string) error { o.primer = true; return nil }},
+
+	{long: "stats", group: "Tokens", help: "Report chars, bytes and tokens of each result as TOON, JSON and pretty JSON",
+		set: func(o *options, _ string) error { o.stats = true; return nil }},
+	{long: "max-tokens", arg: "N", group: "Tokens", help: "Trim arrays and long strings until each TOON result fits in N tokens",
+		set: func(o *options, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("token budget must be a positive integer, got %q", v)
+			}
+			o.maxTokens = n
+			return nil
+		}},
+	{long: "optimize", arg: "MODE", group: "Tokens", help: "Choose the layout and delimiter of each array for the fewest tokens (MODE: " + strings.Join(optimizeModes, ", ") + ")",
+		set: func(o *options, v string) error {
+			if !contains(optimizeModes, v) {
+				return fmt.Errorf("unknown optimization %q (expected one of: %s)", v, strings.Join(optimizeModes, ", "))
+			}
+			o.optimize = v
+			return nil
+		}},
+	{long: "explain", group: "Tokens", help: "With --optimize, explain each choice on stderr",
+		set: func(o *options, _ string) error { o.explain = true; return nil }},
+	{long: "out-dir", arg: "DIR", group: "Tokens", help: "With tq chunk, write each chunk to DIR/chunk-NNNN.toon",
+		set: func(o *options, v string) error {
+			if v == "" {
+				return fmt.Errorf("directory must not be empty")
+			}
+			o.outDir = v
+			return nil
+		}},
+	{long: "tokenizer", arg: "NAME|FILE", group: "Tokens", help: "Vocabulary for token counts: " + tokenizer.DefaultName + " (approximate), " + tokenizer.HeuristicName + ", or a model's .tiktoken file for exact counts (default: " + tokenizer.DefaultName + ")",
+		set: func(o *options, v string) error {
+			if v == "" {
+				return fmt.Errorf("tokenizer must not be empty")
+			}
+			o.tokenizer = v
+			return nil
+		}},
+
+	{long: "template", arg: "FILE", group: "Validation", help: "With tq conform, the template each result must match",
+		set: func(o *options, v string) error {
+			if v == "" {
+				return fmt.Errorf("template must not be empty")
+			}
+			o.template = v
+			return nil
+		}},
+
+	{short: 'i', long: "in-place", group: "Editing", help: "Write the result back to the input file as TOON",
+		set: func(o *options, _ string) error { o.inPlace = true; return nil }},
+	{long: "backup", arg: "SUFFIX", group: "Editing", help: "With --in-place, keep a copy of the original as FILE+SUFFIX",
+		set: func(o *options, v string) error {
+			if v == "" {
+				return fmt.Errorf("suffix must not be empty")
+			}
+			o.backup = v
+			return nil
+		}},
+
+	{short: 'h', long: "help", group: "Help", help: "Show this help message",
+		set: func(o *options, _ string) error { o.showHelp = true; return nil }},
+	{short: 'v', long: "version", group: "Help", help: "Show version",
+		set: func(o *options, _ string) error { o.showVersion = true; return nil }},
+}
+
+// parseArgs parses tq's command line: options may appear anywhere, `--`
+// ends option processing, and the first two operands are the filter and
+// the input file. A leading `chunk` or `conform` selects that command;
+// `tq conform` takes a single operand as the input file.
+func parseArgs(args []string) (*options, error) {
+	o := &options{filter: ".", inputFormat: "auto"}
+	if len(args) > 0 {
+		switch args[0] {
+		case "chunk":
+			o.chunk, args = true, args[1:]
+		case "conform":
+			o.conform, args = true, args[1:]
+		}
+	}
+	operands, err := tqOptions.parse(args, o)
+	if err != nil {
+		return nil, err
+	}
+	if o.conform && len(operands) == 1 {
+		// `tq conform --template FILE reply.toon` checks a file as it is
+		operands = []string{".", operands[0]}
+	}
+	switch len(operands) {
+	case 2:
+		o.inputFile = operands[1]
+		fallthrough
+	case 1:
+		o.filter = operands[0]
+	case 0:
+	default:
+		return nil, fmt.Errorf("unexpected argument '%s'", operands[2])
+	}
+
+	if o.extract != "" {
+		switch {
+		case o.inputFormat != "auto":
+			return nil, fmt.Errorf("--extract reads Markdown and cannot be combined with --input-format")
+		case o.stream:
+			return nil, fmt.Errorf("--extract cannot be combined with --stream")
+		case o.inPlace:
+			return nil, fmt.Errorf("--extract cannot be combined with --in-place")
+		}
+		if o.fenceLangs == "" {
+			o.fenceLangs = "toon"
+		}
+	} else if o.fenceLangs != "" {
+		return nil, fmt.Errorf("--fence-lang requires --extract")
+	}
+
+	if o.recover {
+		switch {
+		case o.inputFormat != "auto" && o.inputFormat != "toon":
+			return nil, fmt.Errorf("--recover only reads TOON input")
+		case o.stream:
+			return nil, fmt.Errorf("--recover cannot be combined with --stream")
+		case o.inPlace:
+			return nil, fmt.Errorf("--recover cannot be combined with --in-place")
+		}
+	}
+
+	if o.follow {
+		switch {
+		case o.inputFormat != "auto" && o.inputFormat != "toon":
+			return nil, fmt.Errorf("--follow-partial only reads TOON input")
+		case o.stream:
+			return nil, fmt.Errorf("--follow-partial cannot be combined with --stream")
+		case o.inPlace:
+			return nil, fmt.Errorf("--follow-partial cannot be combined with --in-place")
+		case o.extract != "":
+			return nil, fmt.Errorf("--follow-partial cannot be combined with --extract")
+		case o.recover:
+			return nil, fmt.Errorf("--follow-partial cannot be combined with --recover")
+		}
+		// Values are only useful as they arrive
+		o.unbuffered = true
+	}
+
+	if o.chunk {
+		switch {
+		case o.maxTokens == 0:
+			return nil, fmt.Errorf("tq chunk requires --max-tokens")
+		case o.outputFormat != "":
+			return nil, fmt.Errorf("tq chunk writes NDJSON records and cannot be combined with %s output", o.outputFormat)
+		case o.inPlace:
+			return nil, fmt.Errorf("tq chunk cannot be combined with --in-place")
+		case o.optimize != "":
+			return nil, fmt.Errorf("tq chunk cannot be combined with --optimize")
+		case o.stream, o.follow:
+			return nil, fmt.Errorf("tq chunk splits whole documents and cannot be combined with --stream or --follow-partial")
+		case o.extract != "":
+			return nil, fmt.Errorf("tq chunk cannot be combined with --extract")
+		case o.stats:
+			return nil, fmt.Errorf("tq chunk cannot be combined with --stats")
+		}
+	} else if o.outDir != "" {
+		return nil, fmt.Errorf("--out-dir requires tq chunk")
+	}
+
+	if o.conform {
+		switch {
+		case o.template == "":
+			return nil, fmt.Errorf("tq conform requires --template")
+		case o.outputFormat != "":
+			return nil, fmt.Errorf("tq conform reports mismatches and cannot be combined with %s output", o.outputFormat)
+		case o.inPlace:
+			return nil, fmt.Errorf("tq conform cannot be combined with --in-place")
+		case o.stats, o.maxTokens > 0, o.optimize != "":
+			return nil, fmt.Errorf("tq conform cannot be combined with --stats, --max-tokens or --optimize")
+		}
+	} else if o.template != "" {
+		return nil, fmt.Errorf("--template requires tq conform")
+	}
+
+	if o.outputFormat == "" && o.raw {
+		o.outputFormat = "raw"
+	}
+	if o.outputFormat == "" {
+		o.outputFormat = outputFormatForFile(o.outputFile)
+	}
+	if o.raw {
+		switch o.outputFormat {
+		case "raw", "compact", "json":
+		default:
+			return nil, fmt.Errorf("--raw only applies to JSON output, not %s", o.outputFormat)
+		}
+	}
+
+	if o.inPlace {
+		switch {
+		case o.inputFile == "" || o.inputFile == "-":
+			return nil, fmt.Errorf("--in-place requires an input file")
+		case o.inputFormat != "auto" && o.inputFormat != "toon":
+			return nil, fmt.Errorf("--in-place only supports TOON input")
+		case o.stream:
+			return nil, fmt.Errorf("--in-place cannot be combined with --stream")
+		case o.outputFile != "":
+			return nil, fmt.Errorf("--in-place cannot be combined with an output file")
+		case o.stats:
+			return nil, fmt.Errorf("--in-place cannot be combined with --stats")
+		case o.maxTokens > 0:
+			return nil, fmt.Errorf("--in-place cannot be combined with --max-tokens")
+		case o.optimize != "":
+			return nil, fmt.Errorf("--in-place cannot be combined with --optimize")
+		case o.outputFormat != "toon":
+			return nil, fmt.Errorf("--in-place always writes TOON and cannot be combined with %s output", o.outputFormat)
+		}
+	} else if o.backup != "" {
+		return nil, fmt.Errorf("--backup requires --in-place")
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"--max-tokens", o.maxTokens > 0}, {"--optimize", o.optimize != ""}} {
+		switch {
+		case !f.set:
+		case o.stats:
+			return nil, fmt.Errorf("%s cannot be combined with --stats", f.name)
+		case o.outputFormat != "toon" && o.outputFormat != "prompt":
+			return nil, fmt.Errorf("%s only supports TOON output, not %s", f.name, o.outputFormat)
+		}
+	}
+	if o.outputFormat != "prompt" {
+		switch {
+		case o.promptLabel != "":
+			return nil, fmt.Errorf("--prompt-label requires --output prompt")
+		case o.primer:
+			return nil, fmt.Errorf("--primer requires --output prompt")
+		}
+	}
+	if o.explain && o.optimize == "" {
+		return nil, fmt.Errorf("--explain requires --optimize")
+	}
+	if o.tokenizer != "" && !o.stats && o.maxTokens == 0 && o.optimize == "" {
+		return nil, fmt.Errorf("--tokenizer requires --stats, --max-tokens or --optimize")
+	}
+	return o, nil
+}
+
+// parse applies the options found in args to o and returns the remaining
+// operands in order. It follows POSIX/GNU conventions: short flags can be
+// combined (-rc), long options accept --name=value, and everything after
+// `--` is an operand. A lone "-" is an operand.
+func (s optionSet) parse(args []string, o *options) ([]string, error) {
+	var operands []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(operands, args[i+1:]...), nil
+
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			opt := s.lookupLong(name)
+			if opt == nil {
+				return nil, s.unknown("--" + name)
+			}
+			if opt.arg == "" {
+				if hasValue {
+					return nil, fmt.Errorf("option '--%s' does not take a value", name)
+				}
+			} else if !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("option '--%s' requires %s", name, opt.arg)
+				}
+				i++
+				value = args[i]
+			}
+			if err := opt.set(o, value); err != nil {
+				return nil, fmt.Errorf("option '--%s': %v", name, err)
+			}
+
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			for j := 1; j < len(arg); j++ {
+				opt := s.lookupShort(arg[j])
+				if opt == nil {
+					return nil, s.unknown("-" + string(arg[j]))
+				}
+				value := ""
+				if opt.arg != "" {
+					value = arg[j+1:]
+					if value == "" {
+						if i+1 >= len(args) {
+							return nil, fmt.Errorf("option '-%c' requires %s", arg[j], opt.arg)
+						}
+						i++
+						value = args[i]
+					}
+					j = len(arg)
+				}
+				if err := opt.set(o, value); err != nil {
+					return nil, fmt.Errorf("option '-%c': %v", opt.short, err)
+				}
+			}
+
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	return operands, nil
+}
+
+// contains reports whether list includes s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s optionSet) lookupLong(name string) *option {
+	for i := range s {
+		if s[i].long == name {
+			return &s[i]
+		}
+	}
+	return nil
+}
+
+func (s optionSet) lookupShort(c byte) *option {
+	for i := range s {
+		if s[i].short != 0 && s[i].short == c {
+			return &s[i]
+		}
+	}
+	return nil
+}
+
+// unknown builds the error for an unrecognized option, suggesting the
+// closest known long option when there is a plausible one.
+func (s optionSet) unknown(flag string) error {
+	name := strings.TrimLeft(flag, "-")
+	best, bestDist := "", 3
+	for _, opt := range s {
+		if d := editDistance(name, opt.long); d < bestDist {
+			best, bestDist = opt.long, d
+		}
+	}
+	if best != "" && len(name) > 1 {
+		return fmt.Errorf("unknown option '%s' (did you mean '--%s'?)", flag, best)
+	}
+	return fmt.Errorf("unknown option '%s'", flag)
+}
+
+// help renders the option table grouped by section, in table order.
+func (s optionSet) help() string {
+	labels := make([]string, len(s))
+	width := 0
+	for i, opt := range s {
+		label := "--" + opt.long
+		if opt.short != 0 {
+			label = "-" + string(opt.short) + ", " + label
+		}
+		if opt.arg != "" {
+			label += " " + opt.arg
+		}
+		labels[i] = label
+		if len(label) > width {
+			width = len(label)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("Options:")
+	group := ""
+	for i, opt := range s {
+		if opt.group != group {
+			if group != "" {
+				b.WriteString("\n")
+			}
+			group = opt.group
+			fmt.Fprintf(&b, "\n  %s:", group)
+		}
+		fmt.Fprintf(&b, "\n    %-*s  %s", width, labels[i], opt.help)
+	}
+	return b.String()
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b: the Levenshtein distance with adjacent transpositions counted as one
+// edit, so "jsno" is one edit away from "json".
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    options
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			args: nil,
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "toon"},
+		},
+		{
+			name: "filter and file",
+			args: []string{".name", "data.toon"},
+			want: options{filter: ".name", inputFile: "data.toon", inputFormat: "auto", outputFormat: "toon"},
+		},
+		{
+			name: "combined short flags",
+			args: []string{"-rM", ".name"},
+			want: options{filter: ".name", inputFormat: "auto", outputFormat: "raw", raw: true, colorSet: true},
+		},
+		{
+			name: "raw with compact",
+			args: []string{"-rc", ".name"},
+			want: options{filter: ".name", inputFormat: "auto", outputFormat: "compact", raw: true},
+		},
+		{
+			name: "compact with raw",
+			args: []string{"-cr", ".name"},
+			want: options{filter: ".name", inputFormat: "auto", outputFormat: "compact", raw: true},
+		},
+		{
+			name: "raw with pretty JSON",
+			args: []string{"--json", "-r", ".name"},
+			want: options{filter: ".name", inputFormat: "auto", outputFormat: "json", raw: true},
+		},
+		{
+			name: "options after operands",
+			args: []string{".", "data.toon", "--json", "-v"},
+			want: options{filter: ".", inputFile: "data.toon", inputFormat: "auto", outputFormat: "json", showVersion: true},
+		},
+		{
+			name: "help anywhere",
+			args: []string{".", "-h"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "toon", showHelp: true},
+		},
+		{
+			name: "double dash ends options",
+			args: []string{"-c", "--", "-1", "-"},
+			want: options{filter: "-1", inputFile: "-", inputFormat: "auto", outputFormat: "compact"},
+		},
+		{
+			name: "input format",
+			args: []string{"-I", "ndjson", "."},
+			want: options{filter: ".", inputFormat: "ndjson", outputFormat: "toon"},
+		},
+		{
+			name: "input format with equals",
+			args: []string{"--input-format=json"},
+			want: options{filter: ".", inputFormat: "json", outputFormat: "toon"},
+		},
+		{
+			name: "YAML in, TOON out",
+			args: []string{"-I", "yaml", "-o", "toon", ".spec", "deploy.yaml"},
+			want: options{filter: ".spec", inputFile: "deploy.yaml", inputFormat: "yaml", outputFormat: "toon"},
+		},
+		{
+			name: "output format",
+			args: []string{"--output=yaml"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "yaml"},
+		},
+		{
+			name: "XML output with root name",
+			args: []string{"-o", "xml", "--xml-root=feed", ".items"},
+			want: options{filter: ".items", inputFormat: "auto", outputFormat: "xml", xmlRoot: "feed"},
+		},
+		{
+			name: "output file picks the format from its extension",
+			args: []string{"-o", "report.xlsx", ".", "data.toon"},
+			want: options{filter: ".", inputFile: "data.toon", inputFormat: "auto", outputFormat: "xlsx", outputFile: "report.xlsx"},
+		},
+		{
+			name: "explicit format wins over the extension",
+			args: []string{"--output", "csv", "-o", "./out.txt"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "csv", outputFile: "./out.txt"},
+		},
+		{
+			name: "output file with an unknown extension writes TOON",
+			args: []string{"-o", "out.txt"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "toon", outputFile: "out.txt"},
+		},
+		{
+			name:    "two output files",
+			args:    []string{"-o", "a.json", "-o", "b.json"},
+			wantErr: "option '-o': output file given twice (a.json and b.json)",
+		},
+		{
+			name:    "in-place with an output file",
+			args:    []string{"-i", "-o", "out.toon", ".", "data.toon"},
+			wantErr: "--in-place cannot be combined with an output file",
+		},
+		{
+			name: "SQL dialect and batch size",
+			args: []string{"-o", "sql", "--sql-dialect", "sqlite", "--sql-batch=500"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "sql", sql: sqlOptions{dialect: "sqlite", batch: 500}},
+		},
+		{
+			name:    "unknown SQL dialect",
+			args:    []string{"--sql-dialect", "oracle"},
+			wantErr: `option '--sql-dialect': unknown SQL dialect "oracle"`,
+		},
+		{
+			name:    "invalid SQL batch size",
+			args:    []string{"--sql-batch", "0"},
+			wantErr: `option '--sql-batch': batch size must be a positive integer, got "0"`,
+		},
+		{
+			name: "key separator and case",
+			args: []string{"-o", "dotenv", "--key-separator", "__", "--key-case=lower"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "dotenv", kv: keyValueOptions{separator: "__", keyCase: "lower"}},
+		},
+		{
+			name:    "unknown key case",
+			args:    []string{"--key-case", "camel"},
+			wantErr: `option '--key-case': unknown key case "camel"`,
+		},
+		{
+			name: "stats with a tokenizer",
+			args: []string{"--stats", "--tokenizer", "heuristic", "-c"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "compact", stats: true, tokenizer: "heuristic"},
+		},
+		{
+			name:    "tokenizer without stats",
+			args:    []string{"--tokenizer=heuristic"},
+			wantErr: "--tokenizer requires --stats, --max-tokens or --optimize",
+		},
+		{
+			name:    "in-place with stats",
+			args:    []string{"-i", "--stats", ".", "data.toon"},
+			wantErr: "--in-place cannot be combined with --stats",
+		},
+		{
+			name: "token budget with a tokenizer",
+			args: []string{"--max-tokens=500", "--tokenizer", "heuristic"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "toon", maxTokens: 500, tokenizer: "heuristic"},
+		},
+		{
+			name:    "invalid token budget",
+			args:    []string{"--max-tokens", "-1"},
+			wantErr: `option '--max-tokens': token budget must be a positive integer, got "-1"`,
+		},
+		{
+			name:    "token budget with JSON output",
+			args:    []string{"--max-tokens", "100", "--json"},
+			wantErr: "--max-tokens only supports TOON output, not json",
+		},
+		{
+			name:    "raw with YAML output",
+			args:    []string{"-r", "-o", "yaml"},
+			wantErr: "--raw only applies to JSON output, not yaml",
+		},
+		{
+			name:    "token budget with stats",
+			args:    []string{"--max-tokens", "100", "--stats"},
+			wantErr: "--max-tokens cannot be combined with --stats",
+		},
+		{
+			name: "optimize with explanations",
+			args: []string{"--optimize", "tokens", "--explain", "--max-tokens", "800"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "toon", optimize: "tokens", explain: true, maxTokens: 800},
+		},
+		{
+			name:    "unknown optimization",
+			args:    []string{"--optimize=speed"},
+			wantErr: `option '--optimize': unknown optimization "speed"`,
+		},
+		{
+			name:    "optimize with YAML output",
+			args:    []string{"--optimize", "tokens", "-o", "yaml"},
+			wantErr: "--optimize only supports TOON output, not yaml",
+		},
+		{
+			name:    "explain without optimize",
+			args:    []string{"--explain"},
+			wantErr: "--explain requires --optimize",
+		},
+		{
+			name: "chunk command",
+			args: []string{"chunk", "--max-tokens", "512", "--out-dir", "chunks", ".users", "data.toon"},
+			want: options{filter: ".users", inputFile: "data.toon", inputFormat: "auto", outputFormat: "toon", maxTokens: 512, chunk: true, outDir: "chunks"},
+		},
+		{
+			name:    "chunk without a budget",
+			args:    []string{"chunk", "."},
+			wantErr: "tq chunk requires --max-tokens",
+		},
+		{
+			name:    "chunk with an output format",
+			args:    []string{"chunk", "--max-tokens", "512", "--json"},
+			wantErr: "tq chunk writes NDJSON records and cannot be combined with json output",
+		},
+		{
+			name:    "chunk with stream",
+			args:    []string{"chunk", "--max-tokens", "512", "--stream"},
+			wantErr: "tq chunk splits whole documents and cannot be combined with --stream or --follow-partial",
+		},
+		{
+			name:    "chunk with follow-partial",
+			args:    []string{"chunk", "--max-tokens", "512", "--follow-partial"},
+			wantErr: "tq chunk splits whole documents and cannot be combined with --stream or --follow-partial",
+		},
+		{
+			name:    "chunk with extract",
+			args:    []string{"chunk", "--max-tokens", "512", "--extract", "fenced"},
+			wantErr: "tq chunk cannot be combined with --extract",
+		},
+		{
+			name:    "chunk with stats",
+			args:    []string{"chunk", "--max-tokens", "512", "--stats"},
+			wantErr: "tq chunk cannot be combined with --stats",
+		},
+		{
+			name:    "out-dir without chunk",
+			args:    []string{"--out-dir", "chunks"},
+			wantErr: "--out-dir requires tq chunk",
+		},
+		{
+			name: "chunk as a filter operand",
+			args: []string{".", "chunk"},
+			want: options{filter: ".", inputFile: "chunk", inputFormat: "auto", outputFormat: "toon"},
+		},
+		{
+			name: "extract fenced blocks",
+			args: []string{"--extract", "fenced", ".items"},
+			want: options{filter: ".items", inputFormat: "auto", outputFormat: "toon", extract: "fenced", fenceLangs: "toon"},
+		},
+		{
+			name: "extract several languages",
+			args: []string{"--extract=fenced", "--fence-lang", "TOON, json,yml"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "toon", extract: "fenced", fenceLangs: "toon,json,yml"},
+		},
+		{
+			name:    "unknown fence language",
+			args:    []string{"--extract", "fenced", "--fence-lang", "toon,python"},
+			wantErr: `option '--fence-lang': unknown language "python"`,
+		},
+		{
+			name:    "fence language without extract",
+			args:    []string{"--fence-lang", "json"},
+			wantErr: "--fence-lang requires --extract",
+		},
+		{
+			name:    "extract with an input format",
+			args:    []string{"--extract", "fenced", "-I", "json"},
+			wantErr: "--extract reads Markdown and cannot be combined with --input-format",
+		},
+		{
+			name: "recover truncated input",
+			args: []string{"--recover", "-I", "toon", ".users"},
+			want: options{filter: ".users", inputFormat: "toon", outputFormat: "toon", recover: true},
+		},
+		{
+			name:    "recover other input formats",
+			args:    []string{"--recover", "-I", "json"},
+			wantErr: "--recover only reads TOON input",
+		},
+		{
+			name:    "recover while streaming",
+			args:    []string{"--recover", "--stream"},
+			wantErr: "--recover cannot be combined with --stream",
+		},
+		{
+			name: "conform to a template",
+			args: []string{"conform", "--template", "expected.toon", "reply.toon"},
+			want: options{filter: ".", inputFile: "reply.toon", inputFormat: "auto", outputFormat: "toon", conform: true, template: "expected.toon"},
+		},
+		{
+			name: "conform with a filter and recovery",
+			args: []string{"conform", "--recover", "--template=t.toon", ".data", "reply.toon"},
+			want: options{filter: ".data", inputFile: "reply.toon", inputFormat: "auto", outputFormat: "toon", recover: true, conform: true, template: "t.toon"},
+		},
+		{
+			name:    "conform without a template",
+			args:    []string{"conform", "reply.toon"},
+			wantErr: "tq conform requires --template",
+		},
+		{
+			name:    "conform with an output format",
+			args:    []string{"conform", "--template", "t.toon", "--json"},
+			wantErr: "tq conform reports mismatches and cannot be combined with json output",
+		},
+		{
+			name:    "template without conform",
+			args:    []string{"--template", "t.toon"},
+			wantErr: "--template requires tq conform",
+		},
+		{
+			name: "follow partial output",
+			args: []string{"--follow-partial", "-c", ".[1]"},
+			want: options{filter: ".[1]", inputFormat: "auto", outputFormat: "compact", follow: true, unbuffered: true},
+		},
+		{
+			name:    "follow partial JSON",
+			args:    []string{"--follow-partial", "-I", "json"},
+			wantErr: "--follow-partial only reads TOON input",
+		},
+		{
+			name:    "follow partial with recover",
+			args:    []string{"--follow-partial", "--recover"},
+			wantErr: "--follow-partial cannot be combined with --recover",
+		},
+		{
+			name: "prompt output with a label and primer",
+			args: []string{"-o", "prompt", "--prompt-label", "Orders", "--primer", "--max-tokens", "500"},
+			want: options{filter: ".", inputFormat: "auto", outputFormat: "prompt", promptLabel: "Orders", primer: true, maxTokens: 500},
+		},
+		{
+			name:    "prompt label without prompt output",
+			args:    []string{"--prompt-label", "Orders"},
+			wantErr: "--prompt-label requires --output prompt",
+		},
+		{
+			name:    "primer with json output",
+			args:    []string{"--json", "--primer"},
+			wantErr: "--primer requires --output prompt",
+		},
+		{
+			name: "slurp combined with other short flags",
+			args: []string{"-sc", "-I", "logfmt", "length"},
+			want: options{filter: "length", inputFormat: "logfmt", outputFormat: "compact", slurp: true},
+		},
+		{
+			name:    "invalid XML root name",
+			args:    []string{"--xml-root", "1st"},
+			wantErr: `option '--xml-root': "1st" is not a valid XML element name`,
+		},
+		{
+			name:    "unknown output format",
+			args:    []string{"-o", "yml"},
+			wantErr: `option '-o': unknown output format "yml" (expected one of: toon, json,`,
+		},
+		{
+			name:    "unknown input format",
+			args:    []string{"-I", "xls"},
+			wantErr: `option '-I': unknown input format "xls" (expected one of: auto, toon, json,`,
+		},
+		{
+			name:    "in-place with JSON input",
+			args:    []string{"-i", "-I", "json", ".", "config.json"},
+			wantErr: "--in-place only supports TOON input",
+		},
+		{
+			name:    "unknown long option with suggestion",
+			args:    []string{"--jsno", "."},
+			wantErr: "unknown option '--jsno' (did you mean '--json'?)",
+		},
+		{
+			name:    "unknown short option",
+			args:    []string{"-cx"},
+			wantErr: "unknown option '-x'",
+		},
+		{
+			name:    "unknown option without suggestion",
+			args:    []string{"--frobnicate"},
+			wantErr: "unknown option '--frobnicate'",
+		},
+		{
+			name:    "value for boolean option",
+			args:    []string{"--compact=yes"},
+			wantErr: "option '--compact' does not take a value",
+		},
+		{
+			name: "in-place with backup",
+			args: []string{"-i", "--backup=.bak", ".version = 2", "config.toon"},
+			want: options{filter: ".version = 2", inputFile: "config.toon", inputFormat: "auto", outputFormat: "toon", inPlace: true, backup: ".bak"},
+		},
+		{
+			name:    "in-place without file",
+			args:    []string{"-i", "."},
+			wantErr: "--in-place requires an input file",
+		},
+		{
+			name:    "in-place with JSON output",
+			args:    []string{"-i", "--json", ".", "config.toon"},
+			wantErr: "--in-place always writes TOON and cannot be combined with json output",
+		},
+		{
+			name:    "backup without in-place",
+			args:    []string{"--backup", ".bak", ".", "config.toon"},
+			wantErr: "--backup requires --in-place",
+		},
+		{
+			name:    "too many operands",
+			args:    []string{".", "a.toon", "b.toon"},
+			wantErr: "unexpected argument 'b.toon'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseArgs(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("parseArgs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseArgs() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("parseArgs() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionValues(t *testing.T) {
+	var value string
+	set := optionSet{
+		{short: 'f', long: "file", arg: "PATH", help: "Read from PATH",
+			set: func(o *options, v string) error { value = v; return nil }},
+		{short: 'c', long: "compact", help: "Compact",
+			set: func(o *options, _ string) error { o.outputFormat = "compact"; return nil }},
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "separate long value", args: []string{"--file", "a.toon"}, want: "a.toon"},
+		{name: "inline long value", args: []string{"--file=a.toon"}, want: "a.toon"},
+		{name: "empty inline long value", args: []string{"--file="}, want: ""},
+		{name: "separate short value", args: []string{"-f", "a.toon"}, want: "a.toon"},
+		{name: "attached short value", args: []string{"-fa.toon"}, want: "a.toon"},
+		{name: "value after combined flags", args: []string{"-cf", "a.toon"}, want: "a.toon"},
+		{name: "missing value", args: []string{"--file"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value = "unset"
+			_, err := set.parse(tt.args, &options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && value != tt.want {
+				t.Errorf("parse() value = %q, want %q", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionHelp(t *testing.T) {
+	help := tqOptions.help()
+	for _, opt := range tqOptions {
+		if !strings.Contains(help, "--"+opt.long) || !strings.Contains(help, opt.help) {
+			t.Errorf("help text is missing --%s", opt.long)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"json", "json", 0},
+		{"jsno", "json", 1},
+		{"jso", "json", 1},
+		{"colour", "color", 1},
+		{"stream", "raw", 4},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// outputFormats lists the values accepted by --output.
+var outputFormats = []string{"toon", "json", "compact", "ndjson", "raw", "yaml", "toml", "xml", "csv", "tsv", "markdown", "html", "msgpack", "cbor", "xlsx", "sql", "dotenv", "properties", "ini", "logfmt", "prompt"}
+
+// outputFormatForFile picks the output format for a file written with
+// -o FILE from its extension, defaulting to TOON.
+func outputFormatForFile(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return "json"
+	case ".jsonl", ".ndjson":
+		return "ndjson"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".xml":
+		return "xml"
+	case ".csv":
+		return "csv"
+	case ".tsv", ".tab":
+		return "tsv"
+	case ".md", ".markdown":
+		return "markdown"
+	case ".html", ".htm":
+		return "html"
+	case ".msgpack", ".mpk":
+		return "msgpack"
+	case ".cbor":
+		return "cbor"
+	case ".xlsx":
+		return "xlsx"
+	case ".sql":
+		return "sql"
+	case ".env":
+		return "dotenv"
+	case ".properties":
+		return "properties"
+	case ".ini", ".cfg":
+		return "ini"
+	case ".logfmt":
+		return "logfmt"
+	}
+	return "toon"
+}
+
+// outputFile is a buffered writer for -o FILE. The file is created on the
+// first write, so a filter that fails before producing anything leaves no
+// file behind.
+type outputFile struct {
+	name string
+	f    *os.File
+	w    *bufio.Writer
+	err  error // the file could not be created
+}
+
+func (o *outputFile) Write(p []byte) (int, error) {
+	if o.err != nil {
+		return 0, o.err
+	}
+	if o.f == nil {
+		f, err := os.Create(o.name)
+		if err != nil {
+			o.err = err
+			return 0, err
+		}
+		o.f, o.w = f, bufio.NewWriter(f)
+	}
+	return o.w.Write(p)
+}
+
+func (o *outputFile) Flush() error {
+	if o.w == nil {
+		return nil
+	}
+	return o.w.Flush()
+}
+
+// Close flushes and closes the file if it was created, and reports any
+// error from creating or writing it.
+func (o *outputFile) Close() error {
+	if o.f == nil {
+		return o.err
+	}
+	err := o.w.Flush()
+	if cerr := o.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// outputError wraps a failure to write a result in the selected format,
+// as opposed to a failure of the filter itself.
+type outputError struct {
+	err error
+}
+
+func (e *outputError) Error() string {
+	return e.err.Error()
+}
+
+// resultWriter prints jq results one at a time in the selected output
+// format, so results can be written as soon as jq produces them.
+type resultWriter struct {
+	w      io.Writer
+	format string
+	opts   *options
+	count  int
+	csv    *csvWriter
+	// tokenizer counts tokens for --stats, --max-tokens and --optimize
+	tokenizer tokenizer.Tokenizer
+	// explain receives the reasons for the choices made by --optimize
+	explain io.Writer
+	// chunks replaces the output format for `tq chunk`
+	chunks *chunker
+	// conformance replaces the output format for `tq conform`
+	conformance *conformer
+}
+
+// write prints a single line of jq's compact output. With --unbuffered
+// the result is flushed before write returns.
+func (rw *resultWriter) write(line string) error {
+	if line == "" {
+		return nil
+	}
+	rw.count++
+	if rw.chunks != nil {
+		if err := rw.chunks.write(line); err != nil {
+			return &outputError{fmt.Errorf("chunking: %v", err)}
+		}
+		return nil
+	}
+	if rw.conformance != nil {
+		if err := rw.conformance.write(line); err != nil {
+			return &outputError{fmt.Errorf("checking the template: %v", err)}
+		}
+		return nil
+	}
+	if rw.opts != nil && rw.opts.stats {
+		// Replace the result by its report
+		report, err := statsReport(line, rw.tokenizer)
+		if err != nil {
+			return &outputError{err}
+		}
+		line = report
+	}
+	if err := rw.writeResult(line); err != nil {
+		return &outputError{err}
+	}
+	if rw.opts != nil && rw.opts.unbuffered {
+		return rw.flush()
+	}
+	return nil
+}
+
+// flush writes out any buffered output.
+func (rw *resultWriter) flush() error {
+	if f, ok := rw.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// close flushes the output and closes it if it is a file.
+func (rw *resultWriter) close() error {
+	if c, ok := rw.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return rw.flush()
+}
+
+func (rw *resultWriter) writeResult(line string) error {
+	if rw.opts != nil && rw.opts.raw {
+		// -r combined with -c or --json still prints strings without quotes
+		if str, ok := rawString(line); ok {
+			fmt.Fprintln(rw.w, str)
+			return nil
+		}
+	}
+	switch rw.format {
+	case "json":
+		// Pretty-print JSON
+		prettyJSON, err := formatJSON(line, true)
+		if err != nil {
+			return fmt.Errorf("formatting JSON: %v", err)
+		}
+		fmt.Fprint(rw.w, prettyJSON)
+
+	case "compact":
+		// Compact JSON (single line)
+		fmt.Fprintln(rw.w, line)
+
+	case "ndjson":
+		// One compact value per line; rows of tabular arrays become records
+		v, err := toon.DecodeJSON([]byte(line))
+		if err != nil {
+			return fmt.Errorf("invalid JSON: %v", err)
+		}
+		rows, ok := v.([]interface{})
+		if !ok || !isTabular(rows) {
+			fmt.Fprintln(rw.w, line)
+			return nil
+		}
+		for _, row := range rows {
+			b, err := compactJSON(row)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(rw.w, b)
+		}
+
+	case "raw":
+		// Raw values without quotes (useful for strings)
+		if str, ok := rawString(line); ok {
+			fmt.Fprintln(rw.w, str)
+			return nil
+		}
+		fmt.Fprintln(rw.w, line)
+
+	case "yaml":
+		// One YAML document per result
+		yamlOutput, err := toYAML(line)
+		if err != nil {
+			return fmt.Errorf("converting to YAML: %v", err)
+		}
+		if rw.count > 1 {
+			fmt.Fprintln(rw.w, "---")
+		}
+		fmt.Fprint(rw.w, yamlOutput)
+
+	case "toml":
+		// TOML has no document separator, so only one result fits
+		if rw.count > 1 {
+			return fmt.Errorf("toml output holds a single document, but the filter produced more than one result")
+		}
+		tomlOutput, err := toTOML(line)
+		if err != nil {
+			return fmt.Errorf("converting to TOML: %v", err)
+		}
+		fmt.Fprint(rw.w, tomlOutput)
+
+	case "xml":
+		// An XML document has a single root element
+		if rw.count > 1 {
+			return fmt.Errorf("xml output holds a single document, but the filter produced more than one result")
+		}
+		xmlOutput, err := toXML(line, rw.opts.xmlRoot)
+		if err != nil {
+			return fmt.Errorf("converting to XML: %v", err)
+		}
+		fmt.Fprint(rw.w, xmlOutput)
+
+	case "csv", "tsv":
+		// Rows from every result share one header
+		if rw.csv == nil {
+			rw.csv = &csvWriter{w: rw.w, format: rw.format, opts: rw.opts.csv}
+		}
+		if err := rw.csv.write(line); err != nil {
+			return fmt.Errorf("converting to %s: %v", strings.ToUpper(rw.format), err)
+		}
+
+	case "markdown", "html":
+		// Tables for arrays of objects, code blocks for anything else
+		render := toMarkdown
+		if rw.format == "html" {
+			render = toHTML
+		}
+		out, err := render(line)
+		if err != nil {
+			return fmt.Errorf("converting to %s: %v", strings.ToUpper(rw.format), err)
+		}
+		if rw.count > 1 {
+			fmt.Fprintln(rw.w)
+		}
+		fmt.Fprint(rw.w, out)
+
+	case "sql":
+		// Statements for each result follow one another
+		sqlOutput, err := toSQL(line, rw.opts.sql)
+		if err != nil {
+			return fmt.Errorf("converting to SQL: %v", err)
+		}
+		if rw.count > 1 {
+			fmt.Fprintln(rw.w)
+		}
+		fmt.Fprint(rw.w, sqlOutput)
+
+	case "logfmt":
+		// One line per record, like ndjson
+		out, err := toLogfmt(line)
+		if err != nil {
+			return fmt.Errorf("converting to logfmt: %v", err)
+		}
+		fmt.Fprint(rw.w, out)
+
+	case "dotenv", "properties", "ini":
+		// Entries from every result follow one another
+		out, err := toKeyValue(line, rw.format, rw.opts.kv)
+		if err != nil {
+			return fmt.Errorf("converting to %s: %v", rw.format, err)
+		}
+		fmt.Fprint(rw.w, out)
+
+	case "msgpack", "cbor":
+		// Binary values are written back to back, without separators
+		encode := toMsgpack
+		if rw.format == "cbor" {
+			encode = toCBOR
+		}
+		data, err := encode(line)
+		if err != nil {
+			return fmt.Errorf("converting to %s: %v", strings.ToUpper(rw.format), err)
+		}
+		rw.w.Write(data)
+
+	case "prompt":
+		// A labeled toon code block, ready to paste into a prompt
+		enc, err := rw.encodeTOON(line)
+		if err != nil {
+			return err
+		}
+		label := rw.opts.promptLabel
+		if label == "" {
+			label = defaultPromptLabel
+		}
+		if rw.count > 1 {
+			fmt.Fprintln(rw.w)
+		}
+		counts := tableCounts(enc.value, enc.maxItems, enc.arrays)
+		fmt.Fprint(rw.w, toPrompt(enc.text, label, counts, rw.opts.primer))
+
+	case "xlsx":
+		// A workbook is a single zip archive
+		if rw.count > 1 {
+			return fmt.Errorf("xlsx output holds a single workbook, but the filter produced more than one result")
+		}
+		data, err := toXLSX(line)
+		if err != nil {
+			return fmt.Errorf("converting to XLSX: %v", err)
+		}
+		rw.w.Write(data)
+
+	default: // "toon"
+		// Add separator between multiple results
+		if rw.count > 1 {
+			fmt.Fprintln(rw.w, "---")
+		}
+		if rw.opts != nil && (rw.opts.maxTokens > 0 || rw.opts.optimize != "") {
+			// Choose array layouts and trim to the token budget natively
+			enc, err := rw.encodeTOON(line)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(rw.w, enc.text)
+			return nil
+		}
+		// Convert each JSON line back to TOON
+		toonOutput, err := jsonToTOON(line)
+		if err != nil {
+			return fmt.Errorf("converting to TOON: %v", err)
+		}
+		fmt.Fprint(rw.w, toonOutput)
+	}
+	return nil
+}
+
+// isTabular reports whether arr is a non-empty array whose elements are
+// all objects, i.e. rows of a table.
+func isTabular(arr []interface{}) bool {
+	if len(arr) == 0 {
+		return false
+	}
+	for _, item := range arr {
+		if _, ok := item.(*toon.Object); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compactJSON encodes v on a single line without escaping HTML characters.
+func compactJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+// rawString returns the value of line if it is a JSON string, as printed
+// by --raw.
+func rawString(line string) (string, bool) {
+	var str string
+	if !strings.HasPrefix(line, `"`) || json.Unmarshal([]byte(line), &str) != nil {
+		return "", false
+	}
+	return str, true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestResultWriterNDJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "tabular array becomes one record per row",
+			results: []string{`[{"id":1,"name":"<Alice>"},{"id":2,"name":"Bob"}]`},
+			want:    "{\"id\":1,\"name\":\"<Alice>\"}\n{\"id\":2,\"name\":\"Bob\"}\n",
+		},
+		{
+			name:    "other values stay on one line",
+			results: []string{`[1,2]`, `{"a":[{"b":1}]}`, `"x"`, `[]`, `[{"a":1},2]`},
+			want:    "[1,2]\n{\"a\":[{\"b\":1}]}\n\"x\"\n[]\n[{\"a\":1},2]\n",
+		},
+		{
+			name:    "key order is kept",
+			results: []string{`[{"z":1,"a":2}]`},
+			want:    "{\"z\":1,\"a\":2}\n",
+		},
+		{
+			name:    "invalid JSON",
+			results: []string{`[{"a":`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			rw := &resultWriter{w: &out, format: "ndjson", opts: &options{}}
+			var err error
+			for _, r := range tt.results {
+				if err = rw.write(r); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && out.String() != tt.want {
+				t.Errorf("write() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestResultWriterUnbuffered(t *testing.T) {
+	for _, unbuffered := range []bool{false, true} {
+		var out strings.Builder
+		rw := &resultWriter{w: bufio.NewWriter(&out), format: "compact", opts: &options{unbuffered: unbuffered}}
+		if err := rw.write(`{"a":1}`); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String() != ""; got != unbuffered {
+			t.Errorf("unbuffered=%v: output visible before flush = %v", unbuffered, got)
+		}
+		if err := rw.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != "{\"a\":1}\n" {
+			t.Errorf("unbuffered=%v: output = %q", unbuffered, out.String())
+		}
+	}
+}
+
+func TestResultWriterRaw(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"raw", "x\n{\"a\":1}\nnull\n"},
+		{"compact", "x\n{\"a\":1}\nnull\n"},
+		{"json", "x\n{\n  \"a\": 1\n}\nnull\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out strings.Builder
+			rw := &resultWriter{w: &out, format: tt.format, opts: &options{raw: true}}
+			for _, line := range []string{`"x"`, `{"a":1}`, `null`} {
+				if err := rw.write(line); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// promptPrimer explains TOON to a model in a few sentences, for --primer.
+const promptPrimer = "The data below is in TOON, a compact form of JSON. Objects are " +
+	"indented `key: value` lines. Arrays declare their length as [N]. Arrays " +
+	"of objects with the same fields name the fields once, as {a,b,c}, then " +
+	"give one row per object with its values in that order, separated by " +
+	"commas or by the tab or | written after N."
+
+// defaultPromptLabel introduces the data when --prompt-label is not given.
+const defaultPromptLabel = "Data"
+
+// toPrompt wraps TOON text for pasting into a prompt, for --output prompt:
+// a label stating the rows of each table, as given by tableCounts, then
+// the text in a toon code fence, optionally preceded by a primer on the
+// format.
+func toPrompt(text, label string, counts []string, primer bool) string {
+	var b strings.Builder
+	if primer {
+		b.WriteString(promptPrimer + "\n\n")
+	}
+	b.WriteString(label)
+	if len(counts) > 0 {
+		b.WriteString(" (" + strings.Join(counts, ", ") + ")")
+	}
+	b.WriteString(":\n")
+
+	// The fence must be longer than any run of backticks in the text
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	b.WriteString(fence + "toon\n" + text + "\n" + fence + "\n")
+	return b.String()
+}
+
+// tableCounts states the rows of each table in v as the encoder writes it
+// with maxItems and the array styles of --optimize, such as "employees: 5
+// rows". Tables with the same key, as inside list items, are added up, and
+// rows left out by --max-tokens are counted as in "employees: 3 of 5
+// rows".
+func tableCounts(v interface{}, maxItems int, arrays map[string]toon.ArrayStyle) []string {
+	// The encoder trims an array before choosing its layout
+	isTable := func(path string, arr []interface{}) bool {
+		if maxItems > 0 && len(arr) > maxItems {
+			arr = arr[:maxItems]
+		}
+		return arrays[path].Layout != toon.List && toon.TabularFields(arr) != nil
+	}
+
+	var keys []string
+	total := make(map[string]int)
+	toon.WalkArrays(v, func(path string, arr []interface{}) {
+		if !isTable(path, arr) {
+			return
+		}
+		key := toon.LastKey(path)
+		if _, seen := total[key]; !seen {
+			keys = append(keys, key)
+		}
+		total[key] += len(arr)
+	})
+	shown := make(map[string]int)
+	toon.WalkArrays(trimArrays(v, maxItems), func(path string, arr []interface{}) {
+		if isTable(path, arr) {
+			shown[toon.LastKey(path)] += len(arr)
+		}
+	})
+
+	var counts []string
+	for _, key := range keys {
+		count := toon.Thousands(total[key]) + " rows"
+		if total[key] == 1 {
+			count = "1 row"
+		}
+		if shown[key] < total[key] {
+			count = toon.Thousands(shown[key]) + " of " + count
+		}
+		if key != "" {
+			count = key + ": " + count
+		}
+		counts = append(counts, count)
+	}
+	return counts
+}
+
+// trimArrays returns a copy of v with every array cut to its first n
+// elements, as the encoder writes it with MaxItems n. v is returned as it
+// is if n is 0.
+func trimArrays(v interface{}, n int) interface{} {
+	if n <= 0 {
+		return v
+	}
+	switch v := v.(type) {
+	case *toon.Object:
+		obj := toon.NewObject()
+		for _, k := range v.Keys() {
+			val, _ := v.Get(k)
+			obj.Set(k, trimArrays(val, n))
+		}
+		return obj
+	case []interface{}:
+		items := make([]interface{}, 0, min(len(v), n))
+		for _, item := range v[:min(len(v), n)] {
+			items = append(items, trimArrays(item, n))
+		}
+		return items
+	}
+	return v
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+func TestToPrompt(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		label  string
+		counts []string
+		primer bool
+		want   string
+	}{
+		{
+			name:   "table counts in the label",
+			text:   "company: Acme\nemployees[2]{id,name}:\n  1,Alice\n  2,Bob",
+			label:  "Data",
+			counts: []string{"employees: 2 rows"},
+			want:   "Data (employees: 2 rows):\n```toon\ncompany: Acme\nemployees[2]{id,name}:\n  1,Alice\n  2,Bob\n```\n",
+		},
+		{
+			name:   "primer and no tables",
+			text:   "a: 1",
+			label:  "Settings",
+			primer: true,
+			want:   promptPrimer + "\n\nSettings:\n```toon\na: 1\n```\n",
+		},
+		{
+			name:  "backticks in the text",
+			text:  "note: \"```\"",
+			label: "Data",
+			want:  "Data:\n````toon\nnote: \"```\"\n````\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toPrompt(tt.text, tt.label, tt.counts, tt.primer); got != tt.want {
+				t.Errorf("toPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableCounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		maxItems int
+		arrays   map[string]toon.ArrayStyle
+		want     []string
+	}{
+		{
+			name:  "root table",
+			input: `[{"a":1,"b":2},{"a":3,"b":4},{"a":5,"b":6}]`,
+			want:  []string{"3 rows"},
+		},
+		{
+			name:  "tables in list items are added up",
+			input: `{"orders":[{"id":1,"items":[{"sku":"A"}]},{"items":[{"sku":"B"},{"sku":"C"}],"id":2}],"line items":[{"x":1}]}`,
+			want:  []string{"items: 3 rows", "line items: 1 row"},
+		},
+		{
+			name:     "rows left out by --max-tokens",
+			input:    `{"users":[{"id":1},{"id":2},{"id":3}],"tags":[{"t":"x"},{"t":"y"}],"orders":[{"items":[{"sku":"A"}]},{"items":[{"sku":"B"}]},{"items":[{"sku":"C"}]}]}`,
+			maxItems: 2,
+			want:     []string{"users: 2 of 3 rows", "tags: 2 rows", "items: 2 of 3 rows"},
+		},
+		{
+			name:   "table written as a list by --optimize",
+			input:  `{"users":[{"id":1}],"tags":[{"t":"x"}]}`,
+			arrays: map[string]toon.ArrayStyle{".users": {Layout: toon.List}},
+			want:   []string{"tags: 1 row"},
+		},
+		{
+			name:  "no tables",
+			input: `{"tags":["a","b"],"note":"x[1]{y}:","mixed":[{"a":1},{"b":2}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := toon.DecodeJSON([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tableCounts(v, tt.maxItems, tt.arrays); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tableCounts() = %s, want %s", strings.Join(got, "; "), strings.Join(tt.want, "; "))
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// recoverValues decodes TOON with the lenient decoder for --recover and
+// returns the value as a line of JSON. Each repair the decoder made is
+// written to w as an NDJSON record, with line numbers counted from
+// firstLine so that they point into the original file.
+func recoverValues(data []byte, firstLine int, w io.Writer) (string, error) {
+	v, repairs, err := toon.DecodeLenient(data)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range repairs {
+		rec := toon.NewObject()
+		rec.Set("repair", r.Kind)
+		rec.Set("line", jsonInt(firstLine+r.Line-1))
+		if r.Path != "" {
+			rec.Set("path", r.Path)
+		}
+		rec.Set("message", r.Msg)
+		line, err := compactJSON(rec)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(w, line)
+	}
+	s, err := compactJSON(v)
+	if err != nil {
+		return "", err
+	}
+	return s + "\n", nil
+}
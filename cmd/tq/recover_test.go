@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecoverValues(t *testing.T) {
+	var report strings.Builder
+	got, err := recoverValues([]byte("rows[3]{a,b}:\n  1,2\n  3"), 10, &report)
+	if err != nil {
+		t.Fatalf("recoverValues() error = %v", err)
+	}
+	if want := `{"rows":[{"a":1,"b":2}]}` + "\n"; got != want {
+		t.Errorf("recoverValues() = %q, want %q", got, want)
+	}
+	wantReport := `{"repair":"truncated","line":12,"message":"dropped incomplete last line: row has 1 values but header declares 2 fields"}
+{"repair":"length","line":12,"path":".rows","message":"array declares 3 items but has 1"}
+`
+	if report.String() != wantReport {
+		t.Errorf("report =\n%s\nwant\n%s", report.String(), wantReport)
+	}
+}
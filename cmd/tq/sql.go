@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// sqlDialects lists the values accepted by --sql-dialect.
+var sqlDialects = []string{"postgres", "mysql", "sqlite"}
+
+// defaultSQLBatch is the number of rows per INSERT statement.
+const defaultSQLBatch = 100
+
+// sqlOptions holds the settings for SQL output.
+type sqlOptions struct {
+	dialect string // one of sqlDialects; empty selects postgres
+	batch   int    // rows per INSERT; 0 selects defaultSQLBatch
+}
+
+// sqlType is the inferred type of a column.
+type sqlType int
+
+const (
+	sqlText sqlType = iota
+	sqlBoolean
+	sqlInteger
+	sqlBigint
+	sqlDecimal // integers that do not fit in 64 bits
+	sqlFloat
+	sqlJSON
+)
+
+// sqlTypeNames maps each dialect to its column type names, indexed by
+// sqlType.
+var sqlTypeNames = map[string][]string{
+	"postgres": {"TEXT", "BOOLEAN", "INTEGER", "BIGINT", "NUMERIC", "DOUBLE PRECISION", "JSONB"},
+	"mysql":    {"TEXT", "BOOLEAN", "INT", "BIGINT", "DECIMAL(65, 0)", "DOUBLE", "JSON"},
+	"sqlite":   {"TEXT", "INTEGER", "INTEGER", "INTEGER", "NUMERIC", "REAL", "TEXT"},
+}
+
+// sqlTable is a tabular array to be written as a table.
+type sqlTable struct {
+	name    string
+	t       *table
+	types   []sqlType
+	notNull []bool
+}
+
+// toSQL renders the tabular arrays in one JSON value as CREATE TABLE and
+// INSERT statements. Arrays of objects nested in objects are named after
+// their key path joined with underscores; an array of objects on its own
+// becomes the table "data".
+func toSQL(jsonInput string, opts sqlOptions) (string, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	if opts.dialect == "" {
+		opts.dialect = "postgres"
+	}
+	if opts.batch <= 0 {
+		opts.batch = defaultSQLBatch
+	}
+
+	var tables []*sqlTable
+	var collect func(path []string, v interface{})
+	collect = func(path []string, v interface{}) {
+		if t := newTable(v); t != nil {
+			name := "data"
+			if len(path) > 0 {
+				name = strings.Join(path, "_")
+			}
+			tables = append(tables, newSQLTable(name, t))
+			return
+		}
+		if obj, ok := v.(*toon.Object); ok {
+			for _, k := range obj.Keys() {
+				val, _ := obj.Get(k)
+				collect(append(path[:len(path):len(path)], k), val)
+			}
+		}
+	}
+	collect(nil, v)
+	if len(tables) == 0 {
+		return "", fmt.Errorf("sql output needs an array of objects, but the %s has none", jsonType(v))
+	}
+
+	var b strings.Builder
+	for i, st := range tables {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if err := st.write(&b, opts); err != nil {
+			return "", fmt.Errorf("table %s: %v", st.name, err)
+		}
+	}
+	return b.String(), nil
+}
+
+// newSQLTable infers the type of each column from its non-null values.
+// Columns that mix types are TEXT; columns with nested values are JSON.
+func newSQLTable(name string, t *table) *sqlTable {
+	st := &sqlTable{name: name, t: t, types: make([]sqlType, len(t.columns)), notNull: make([]bool, len(t.columns))}
+	for i, c := range t.columns {
+		typ, seen, mixed := sqlText, false, false
+		st.notNull[i] = true
+		for _, row := range t.rows {
+			val, _ := row.Get(c)
+			if val == nil {
+				st.notNull[i] = false
+				continue
+			}
+			vt := sqlValueType(val)
+			switch {
+			case !seen:
+				typ, seen = vt, true
+			case vt == typ:
+			case isSQLNumber(vt) && isSQLNumber(typ):
+				// Numbers widen to the larger type
+				if vt > typ {
+					typ = vt
+				}
+			default:
+				mixed = true
+			}
+		}
+		if mixed {
+			typ = sqlText
+		}
+		st.types[i] = typ
+	}
+	return st
+}
+
+func isSQLNumber(t sqlType) bool {
+	return t >= sqlInteger && t <= sqlFloat
+}
+
+// sqlValueType returns the narrowest column type that holds v.
+func sqlValueType(v interface{}) sqlType {
+	switch v := v.(type) {
+	case bool:
+		return sqlBoolean
+	case json.Number:
+		s := string(v)
+		if strings.ContainsAny(s, ".eE") {
+			return sqlFloat
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		switch {
+		case err != nil:
+			return sqlDecimal
+		case n < math.MinInt32 || n > math.MaxInt32:
+			return sqlBigint
+		}
+		return sqlInteger
+	case *toon.Object, []interface{}:
+		return sqlJSON
+	}
+	return sqlText
+}
+
+// write prints the CREATE TABLE statement followed by INSERT statements of
+// at most opts.batch rows each.
+func (st *sqlTable) write(b *strings.Builder, opts sqlOptions) error {
+	names := sqlTypeNames[opts.dialect]
+	table := sqlIdent(st.name, opts.dialect)
+	columns := make([]string, len(st.t.columns))
+	for i, c := range st.t.columns {
+		columns[i] = sqlIdent(c, opts.dialect)
+	}
+
+	fmt.Fprintf(b, "CREATE TABLE %s (\n", table)
+	for i, c := range columns {
+		def := c + " " + names[st.types[i]]
+		if st.notNull[i] {
+			def += " NOT NULL"
+		}
+		if i < len(columns)-1 {
+			def += ","
+		}
+		fmt.Fprintf(b, "  %s\n", def)
+	}
+	b.WriteString(");\n")
+
+	for start := 0; start < len(st.t.rows); start += opts.batch {
+		end := min(start+opts.batch, len(st.t.rows))
+		fmt.Fprintf(b, "\nINSERT INTO %s (%s) VALUES\n", table, strings.Join(columns, ", "))
+		for r, row := range st.t.rows[start:end] {
+			values := make([]string, len(st.t.columns))
+			for i, c := range st.t.columns {
+				val, _ := row.Get(c)
+				s, err := sqlLiteral(val, st.types[i], opts.dialect)
+				if err != nil {
+					return fmt.Errorf("row %d, column %s: %v", start+r+1, c, err)
+				}
+				values[i] = s
+			}
+			sep := ","
+			if start+r == end-1 {
+				sep = ";"
+			}
+			fmt.Fprintf(b, "  (%s)%s\n", strings.Join(values, ", "), sep)
+		}
+	}
+	return nil
+}
+
+// sqlLiteral renders v as a literal for a column of type typ.
+func sqlLiteral(v interface{}, typ sqlType, dialect string) (string, error) {
+	if v == nil {
+		return "NULL", nil
+	}
+	switch typ {
+	case sqlBoolean:
+		if dialect == "sqlite" {
+			if v.(bool) {
+				return "1", nil
+			}
+			return "0", nil
+		}
+		return strings.ToUpper(strconv.FormatBool(v.(bool))), nil
+	case sqlInteger, sqlBigint, sqlDecimal, sqlFloat:
+		return string(v.(json.Number)), nil
+	}
+
+	// Text and JSON columns hold strings; other values are written as JSON
+	s, ok := v.(string)
+	if !ok {
+		var err error
+		if s, err = compactJSON(v); err != nil {
+			return "", err
+		}
+	}
+	return sqlString(s, dialect), nil
+}
+
+// sqlIdent quotes an identifier for the dialect.
+func sqlIdent(name, dialect string) string {
+	if dialect == "mysql" {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqlString quotes a string literal. MySQL also treats backslashes as
+// escapes by default, so they are doubled there.
+func sqlString(s, dialect string) string {
+	if dialect == "mysql" {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
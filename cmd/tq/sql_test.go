@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		opts    sqlOptions
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "tabular array with inferred types",
+			input: `{"company":"Acme","employees":[{"id":1,"name":"Alice","salary":95000.5,"active":true},{"id":2,"name":"Bob","salary":85000,"active":false}]}`,
+			want: `CREATE TABLE "employees" (
+  "id" INTEGER NOT NULL,
+  "name" TEXT NOT NULL,
+  "salary" DOUBLE PRECISION NOT NULL,
+  "active" BOOLEAN NOT NULL
+);
+
+INSERT INTO "employees" ("id", "name", "salary", "active") VALUES
+  (1, 'Alice', 95000.5, TRUE),
+  (2, 'Bob', 85000, FALSE);
+`,
+		},
+		{
+			name:  "nulls, missing fields, mixed and nested values",
+			input: `[{"a":1,"b":"x","c":{"k":1}},{"a":null,"b":2,"d":"it's"}]`,
+			want: `CREATE TABLE "data" (
+  "a" INTEGER,
+  "b" TEXT NOT NULL,
+  "c" JSONB,
+  "d" TEXT
+);
+
+INSERT INTO "data" ("a", "b", "c", "d") VALUES
+  (1, 'x', '{"k":1}', NULL),
+  (NULL, '2', NULL, 'it''s');
+`,
+		},
+		{
+			name:  "mysql quoting and types",
+			input: "{\"t\":[{\"path\":\"C:\\\\tmp\",\"n\":3000000000,\"ok\":true,\"`x`\":1}]}",
+			opts:  sqlOptions{dialect: "mysql"},
+			want: "CREATE TABLE `t` (\n" +
+				"  `path` TEXT NOT NULL,\n" +
+				"  `n` BIGINT NOT NULL,\n" +
+				"  `ok` BOOLEAN NOT NULL,\n" +
+				"  ```x``` INT NOT NULL\n" +
+				");\n\n" +
+				"INSERT INTO `t` (`path`, `n`, `ok`, ```x```) VALUES\n" +
+				"  ('C:\\\\tmp', 3000000000, TRUE, 1);\n",
+		},
+		{
+			name:  "sqlite booleans and batches",
+			input: `{"flags":[{"on":true},{"on":false},{"on":true}]}`,
+			opts:  sqlOptions{dialect: "sqlite", batch: 2},
+			want: `CREATE TABLE "flags" (
+  "on" INTEGER NOT NULL
+);
+
+INSERT INTO "flags" ("on") VALUES
+  (1),
+  (0);
+
+INSERT INTO "flags" ("on") VALUES
+  (1);
+`,
+		},
+		{
+			name:  "nested tables are named after their path",
+			input: `{"org":{"teams":[{"id":1}]},"tags":["a"]}`,
+			want:  "CREATE TABLE \"org_teams\" (\n  \"id\" INTEGER NOT NULL\n);\n\nINSERT INTO \"org_teams\" (\"id\") VALUES\n  (1);\n",
+		},
+		{
+			name:    "no tabular array",
+			input:   `{"a":1,"b":[1,2]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toSQL(tt.input, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toSQL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("toSQL() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLValueType(t *testing.T) {
+	// A column of integers widens to the largest type among its values
+	got, err := toSQL(`[{"n":1},{"n":12345678901234567890},{"n":2}]`, sqlOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, `"n" NUMERIC NOT NULL`) {
+		t.Errorf("toSQL() =\n%s\nwant a NUMERIC column", got)
+	}
+}
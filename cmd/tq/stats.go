@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// encodings renders a value as TOON, compact JSON and pretty JSON, in the
+// order they appear in a --stats report.
+func encodings(v interface{}) (toonText, compact, pretty string, err error) {
+	if toonText, err = toon.Encode(v, nil); err != nil {
+		return "", "", "", err
+	}
+	if compact, err = compactJSON(v); err != nil {
+		return "", "", "", err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(compact), "", "  "); err != nil {
+		return "", "", "", err
+	}
+	return toonText, compact, buf.String(), nil
+}
+
+// statsReport measures one JSON value as TOON, compact JSON and pretty
+// JSON and returns the report as a JSON line, so that it can be written in
+// any output format. For an object the report also breaks the TOON tokens
+// down by top-level key, largest first.
+func statsReport(jsonInput string, tok tokenizer.Tokenizer) (string, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	toonText, compact, pretty, err := encodings(v)
+	if err != nil {
+		return "", err
+	}
+
+	report := toon.NewObject()
+	report.Set("tokenizer", tok.Name())
+	counts := make(map[string]int)
+	var formats []interface{}
+	for _, f := range []struct{ name, text string }{{"toon", toonText}, {"json", compact}, {"pretty_json", pretty}} {
+		counts[f.name] = tok.Count(f.text)
+		row := toon.NewObject()
+		row.Set("format", f.name)
+		row.Set("chars", jsonInt(utf8.RuneCountInString(f.text)))
+		row.Set("bytes", jsonInt(len(f.text)))
+		row.Set("tokens", jsonInt(counts[f.name]))
+		formats = append(formats, row)
+	}
+	report.Set("formats", formats)
+	report.Set("toon_vs_json", percentChange(counts["toon"], counts["json"]))
+	report.Set("toon_vs_pretty_json", percentChange(counts["toon"], counts["pretty_json"]))
+
+	if obj, ok := v.(*toon.Object); ok && obj.Len() > 0 {
+		type keyStats struct {
+			key                string
+			toon, json, pretty int
+		}
+		var keys []keyStats
+		for _, k := range obj.Keys() {
+			val, _ := obj.Get(k)
+			field := toon.NewObject()
+			field.Set(k, val)
+			t, c, p, err := encodings(field)
+			if err != nil {
+				return "", err
+			}
+			keys = append(keys, keyStats{k, tok.Count(t), tok.Count(c), tok.Count(p)})
+		}
+		sort.SliceStable(keys, func(i, j int) bool { return keys[i].toon > keys[j].toon })
+
+		var rows []interface{}
+		for _, k := range keys {
+			row := toon.NewObject()
+			row.Set("key", k.key)
+			row.Set("toon", jsonInt(k.toon))
+			row.Set("json", jsonInt(k.json))
+			row.Set("pretty_json", jsonInt(k.pretty))
+			row.Set("share", percent(k.toon, counts["toon"]))
+			rows = append(rows, row)
+		}
+		report.Set("keys", rows)
+	}
+	return compactJSON(report)
+}
+
+func jsonInt(n int) json.Number {
+	return json.Number(strconv.Itoa(n))
+}
+
+// percent formats part as a percentage of whole, e.g. "42.5%".
+func percent(part, whole int) string {
+	if whole == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)*100/float64(whole))
+}
+
+// percentChange formats how much smaller or larger n is than base, e.g.
+// "-38.2%".
+func percentChange(n, base int) string {
+	if base == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%+.1f%%", float64(n-base)*100/float64(base))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+)
+
+func TestStatsReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "object with a per-key breakdown",
+			input: `{"users":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"ok":true}`,
+			want: `{"tokenizer":"heuristic",` +
+				`"formats":[{"format":"toon","chars":45,"bytes":45,"tokens":24},{"format":"json","chars":67,"bytes":67,"tokens":28},{"format":"pretty_json","chars":131,"bytes":131,"tokens":58}],` +
+				`"toon_vs_json":"-14.3%","toon_vs_pretty_json":"-58.6%",` +
+				`"keys":[{"key":"users","toon":19,"json":23,"pretty_json":51,"share":"79.2%"},{"key":"ok","toon":4,"json":5,"pretty_json":9,"share":"16.7%"}]}`,
+		},
+		{
+			name:  "scalar without keys",
+			input: `"héllo"`,
+			want: `{"tokenizer":"heuristic",` +
+				`"formats":[{"format":"toon","chars":5,"bytes":6,"tokens":2},{"format":"json","chars":7,"bytes":8,"tokens":3},{"format":"pretty_json","chars":7,"bytes":8,"tokens":3}],` +
+				`"toon_vs_json":"-33.3%","toon_vs_pretty_json":"-33.3%"}`,
+		},
+		{
+			name:    "invalid JSON",
+			input:   `{"a":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := statsReport(tt.input, tokenizer.Heuristic{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("statsReport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("statsReport() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsOutput(t *testing.T) {
+	var buf bytes.Buffer
+	rw := &resultWriter{w: &buf, format: "markdown", opts: &options{stats: true}, tokenizer: tokenizer.Heuristic{}}
+	if err := rw.write(`[{"id":1},{"id":2}]`); err != nil {
+		t.Fatal(err)
+	}
+	want := "formats[3]{format,chars,bytes,tokens}:\n  toon,16,16,12\n"
+	if !bytes.Contains(buf.Bytes(), []byte(want)) {
+		t.Errorf("markdown stats output =\n%s\nwant it to contain\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// writeStreamEvents decodes TOON from r and writes one [path, leaf] event
+// per line to w, in the same format as `jq --stream`. Only decoding errors
+// are returned: if w stops accepting data, the consumer has gone away and
+// will report its own error.
+func writeStreamEvents(r io.Reader, w io.Writer) error {
+	dec := toon.NewDecoder(r)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for {
+		ev, err := dec.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(ev); err != nil {
+			return nil
+		}
+	}
+}
+
+// writePartialValues decodes TOON from r as it arrives, for
+// --follow-partial, and writes one [path, value] pair per line to w for
+// each field and row as soon as its line is complete. w is flushed after
+// every read so that jq sees values while r is still open. As with
+// writeStreamEvents, only decoding errors are returned.
+func writePartialValues(r io.Reader, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	var writeErr error
+	dec := toon.NewPushDecoder(func(path []interface{}, v interface{}) {
+		if writeErr == nil {
+			writeErr = enc.Encode(toon.Event{Path: path, Value: v})
+		}
+	})
+	flusher, _ := w.(interface{ Flush() error })
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, decodeErr := dec.Write(buf[:n]); decodeErr != nil {
+				return decodeErr
+			}
+			if writeErr == nil && flusher != nil {
+				writeErr = flusher.Flush()
+			}
+		}
+		if writeErr != nil {
+			return nil
+		}
+		if err == io.EOF {
+			if err := dec.Close(); err != nil {
+				return err
+			}
+			return writeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeJSONStream writes input in a format other than TOON to w as JSON for
+// `jq --stream`. JSON and NDJSON are copied as they are read, since jq
+// streams them natively; other formats are converted with decodeInput
+// first. As with writeStreamEvents, only decoding errors are returned.
+func writeJSONStream(format string, r io.Reader, w io.Writer, opts *options) error {
+	if format == "json" || format == "ndjson" {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				if _, err := w.Write(buf[:n]); err != nil {
+					return nil
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	jsonData, err := decodeInput(format, data, opts)
+	if err != nil {
+		return err
+	}
+	// A failed write means jq has stopped reading and reports on its own
+	io.WriteString(w, jsonData)
+	return nil
+}
+
+// runJQ runs jq with filter while produce writes its input, and passes each
+// output line to emit as soon as jq prints it. Unlike applyJQ, neither the
+// input nor the output is held in memory. A filter such as first(inputs)
+// may exit before reading all of its input; once jq has exited
+// successfully, the broken pipe that leaves for produce is not an error.
+func runJQ(filter string, color bool, extraArgs []string, produce func(io.Writer) error, emit func(string) error) error {
+	// Check if jq is installed
+	if _, err := exec.LookPath("jq"); err != nil {
+		return fmt.Errorf("jq is not installed. Please install jq to use tq")
+	}
+
+	args := []string{"-c"}
+	if color {
+		args = append(args, "-C")
+	} else {
+		args = append(args, "-M")
+	}
+	args = append(args, extraArgs...)
+	args = append(args, filter)
+
+	cmd := exec.Command("jq", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	produced := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriter(stdin)
+		err := produce(w)
+		if err == nil {
+			err = w.Flush()
+		}
+		stdin.Close()
+		produced <- err
+	}()
+
+	var emitErr error
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" && emitErr == nil {
+			emitErr = emit(strings.TrimRight(line, "\n"))
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	produceErr := <-produced
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%v: %s", err, stderr.String())
+	}
+	if produceErr != nil && !isBrokenPipe(produceErr) {
+		return produceErr
+	}
+	return emitErr
+}
+
+// isBrokenPipe reports whether err comes from writing to a pipe whose
+// reader has gone away.
+func isBrokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, os.ErrClosed)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestWriteStreamEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "nested object",
+			input: "a: 1\nb:\n  c: x",
+			want:  "[[\"a\"],1]\n[[\"b\",\"c\"],\"x\"]\n[[\"b\",\"c\"]]\n[[\"b\"]]\n",
+		},
+		{
+			name:  "root primitive",
+			input: "42",
+			want:  "[[],42]\n",
+		},
+		{
+			name:    "invalid TOON",
+			input:   "items[2]: a",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := writeStreamEvents(strings.NewReader(tt.input), &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writeStreamEvents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && out.String() != tt.want {
+				t.Errorf("writeStreamEvents() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePartialValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "fields and rows",
+			input: "a: 1\nrows[2]{id,name}:\n  1,x\n  2,y\nb:\n  c: z",
+			want:  "[[\"a\"],1]\n[[\"rows\",0],{\"id\":1,\"name\":\"x\"}]\n[[\"rows\",1],{\"id\":2,\"name\":\"y\"}]\n[[\"b\",\"c\"],\"z\"]\n",
+		},
+		{
+			name:  "root primitive",
+			input: "42",
+			want:  "[[],42]\n",
+		},
+		{
+			name:    "invalid TOON",
+			input:   "items[2]: a",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := writePartialValues(strings.NewReader(tt.input), &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writePartialValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && out.String() != tt.want {
+				t.Errorf("writePartialValues() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunJQStream(t *testing.T) {
+	input := "users[3]{name,age}:\n  Alice,25\n  Bob,30\n  Charlie,35\n"
+
+	tests := []struct {
+		name      string
+		filter    string
+		nullInput bool
+		want      []string
+	}{
+		{
+			name:   "select events",
+			filter: `select(length == 2 and .[0][2] == "name") | .[1]`,
+			want:   []string{`"Alice"`, `"Bob"`, `"Charlie"`},
+		},
+		{
+			name:      "fromstream rebuilds rows",
+			filter:    `fromstream(2 | truncate_stream(inputs)) | .age`,
+			nullInput: true,
+			want:      []string{"25", "30", "35"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []string
+			if tt.nullInput {
+				args = append(args, "-n")
+			}
+			var got []string
+			err := runJQ(tt.filter, false, args, func(w io.Writer) error {
+				return writeStreamEvents(strings.NewReader(input), w)
+			}, func(line string) error {
+				got = append(got, line)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("runJQ() error = %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("runJQ() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunJQStreamOtherFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   []string
+	}{
+		{
+			name:   "json",
+			format: "json",
+			input:  `{"a":1,"b":[true]}`,
+			want:   []string{`[["a"],1]`, `[["b",0],true]`, `[["b",0]]`, `[["b"]]`},
+		},
+		{
+			name:   "yaml",
+			format: "yaml",
+			input:  "a: 1\nb:\n  - true\n",
+			want:   []string{`[["a"],1]`, `[["b",0],true]`, `[["b",0]]`, `[["b"]]`},
+		},
+		{
+			name:   "csv",
+			format: "csv",
+			input:  "name,age\nAlice,25\n",
+			want:   []string{`[[0,"name"],"Alice"]`, `[[0,"age"],25]`, `[[0,"age"]]`, `[[0]]`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			var decodeErr error
+			err := runJQ(".", false, []string{"--stream"}, func(w io.Writer) error {
+				decodeErr = writeJSONStream(tt.format, strings.NewReader(tt.input), w, &options{})
+				return decodeErr
+			}, func(line string) error {
+				got = append(got, line)
+				return nil
+			})
+			if decodeErr != nil {
+				t.Fatalf("writeJSONStream() error = %v", decodeErr)
+			}
+			if err != nil {
+				t.Fatalf("runJQ() error = %v", err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("runJQ() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunJQEarlyExit(t *testing.T) {
+	// Far more than a pipe buffer holds, so jq exits while input is pending
+	var b strings.Builder
+	b.WriteString("rows[50000]{id,name}:\n")
+	for i := 0; i < 50000; i++ {
+		fmt.Fprintf(&b, "  %d,user%d\n", i, i)
+	}
+	input := b.String()
+
+	tests := []struct {
+		name    string
+		produce func(io.Writer) error
+		want    string
+	}{
+		{
+			name:    "stream events",
+			produce: func(w io.Writer) error { return writeStreamEvents(strings.NewReader(input), w) },
+			want:    `[["rows",0,"id"],0]`,
+		},
+		{
+			name:    "partial values",
+			produce: func(w io.Writer) error { return writePartialValues(strings.NewReader(input), w) },
+			want:    `[["rows",0],{"id":0,"name":"user0"}]`,
+		},
+		{
+			name: "whole input",
+			produce: func(w io.Writer) error {
+				_, err := io.WriteString(w, strings.Repeat(`{"id":1}`+"\n", 50000))
+				return err
+			},
+			want: `{"id":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := runJQ("first(inputs)", false, []string{"-n"}, tt.produce, func(line string) error {
+				got = append(got, line)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("runJQ() error = %v", err)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("runJQ() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONStreamReadError(t *testing.T) {
+	readErr := errors.New("disk on fire")
+	err := writeJSONStream("json", iotest.ErrReader(readErr), io.Discard, &options{})
+	if !errors.Is(err, readErr) {
+		t.Errorf("writeJSONStream() error = %v, want %v", err, readErr)
+	}
+}
+
+func TestRunJQInvalidFilter(t *testing.T) {
+	err := runJQ("..invalid", false, nil, func(w io.Writer) error {
+		return writeStreamEvents(strings.NewReader("a: 1"), w)
+	}, func(string) error { return nil })
+	if err == nil {
+		t.Error("runJQ() with invalid filter should fail")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// table is a result laid out as rows and columns for Markdown and HTML
+// output. Columns follow the TOON tabular header: the keys of the first
+// row, followed by keys that only appear in later rows.
+type table struct {
+	columns []string
+	numeric []bool // the column holds numbers and nulls only
+	rows    []*toon.Object
+}
+
+// newTable returns the table for v, or nil if v is not a non-empty array
+// of objects.
+func newTable(v interface{}) *table {
+	arr, ok := v.([]interface{})
+	if !ok || !isTabular(arr) {
+		return nil
+	}
+	t := &table{}
+	seen := make(map[string]bool)
+	for _, item := range arr {
+		row := item.(*toon.Object)
+		t.rows = append(t.rows, row)
+		for _, k := range row.Keys() {
+			if !seen[k] {
+				seen[k] = true
+				t.columns = append(t.columns, k)
+			}
+		}
+	}
+	t.numeric = make([]bool, len(t.columns))
+	for i, c := range t.columns {
+		numbers, others := 0, 0
+		for _, row := range t.rows {
+			switch val, _ := row.Get(c); val.(type) {
+			case nil:
+			case json.Number:
+				numbers++
+			default:
+				others++
+			}
+		}
+		t.numeric[i] = numbers > 0 && others == 0
+	}
+	return t
+}
+
+// cell returns the text of a cell. Nested values are rendered as TOON,
+// one line per element of lines; scalars have no lines.
+func cell(v interface{}) (text string, lines []string, err error) {
+	switch v := v.(type) {
+	case *toon.Object, []interface{}:
+		s, err := toon.Encode(v, nil)
+		if err != nil {
+			return "", nil, err
+		}
+		return s, strings.Split(s, "\n"), nil
+	case nil:
+		return "", nil, nil
+	case json.Number:
+		return toon.FormatNumber(v), nil, nil
+	}
+	s, err := csvCell(v)
+	return s, nil, err
+}
+
+// toMarkdown renders one JSON value as a GitHub-flavored Markdown table,
+// or as a fenced TOON code block if it is not an array of objects.
+func toMarkdown(jsonInput string) (string, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	t := newTable(v)
+	if t == nil {
+		s, err := toon.Encode(v, nil)
+		if err != nil {
+			return "", err
+		}
+		return "```toon\n" + s + "\n```\n", nil
+	}
+
+	var b strings.Builder
+	header := make([]string, len(t.columns))
+	align := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		header[i] = markdownEscape(c)
+		align[i] = "---"
+		if t.numeric[i] {
+			align[i] = "---:"
+		}
+	}
+	fmt.Fprintf(&b, "| %s |\n| %s |\n", strings.Join(header, " | "), strings.Join(align, " | "))
+
+	for _, row := range t.rows {
+		cells := make([]string, len(t.columns))
+		for i, c := range t.columns {
+			val, _ := row.Get(c)
+			text, lines, err := cell(val)
+			if err != nil {
+				return "", fmt.Errorf("column %q: %v", c, err)
+			}
+			if lines == nil {
+				cells[i] = markdownEscape(text)
+				continue
+			}
+			// Code spans cannot span lines inside a table cell
+			for j, line := range lines {
+				lines[j] = strings.ReplaceAll(markdownCode(line), "|", `\|`)
+			}
+			cells[i] = strings.Join(lines, "<br>")
+		}
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+	}
+	return b.String(), nil
+}
+
+// markdownEscape escapes text so that it renders literally in a table
+// cell.
+func markdownEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\', '`', '*', '_', '[', ']', '<', '>', '|', '#':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString("<br>")
+		case '\r':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// markdownCode wraps s in a code span, using a longer fence if s contains
+// backticks.
+func markdownCode(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if fence != "`" {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
+
+// toHTML renders one JSON value as an HTML table, or as a preformatted
+// TOON block if it is not an array of objects.
+func toHTML(jsonInput string) (string, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	t := newTable(v)
+	if t == nil {
+		s, err := toon.Encode(v, nil)
+		if err != nil {
+			return "", err
+		}
+		return "<pre><code class=\"language-toon\">" + html.EscapeString(s) + "</code></pre>\n", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("<table>\n  <thead>\n    <tr>")
+	for i, c := range t.columns {
+		fmt.Fprintf(&b, "<th%s>%s</th>", htmlAlign(t.numeric[i]), html.EscapeString(c))
+	}
+	b.WriteString("</tr>\n  </thead>\n  <tbody>\n")
+	for _, row := range t.rows {
+		b.WriteString("    <tr>")
+		for i, c := range t.columns {
+			val, _ := row.Get(c)
+			text, lines, err := cell(val)
+			if err != nil {
+				return "", fmt.Errorf("column %q: %v", c, err)
+			}
+			switch {
+			case len(lines) > 1:
+				text = "<pre>" + html.EscapeString(text) + "</pre>"
+			case lines != nil:
+				text = "<code>" + html.EscapeString(text) + "</code>"
+			default:
+				text = strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+			}
+			fmt.Fprintf(&b, "<td%s>%s</td>", htmlAlign(t.numeric[i]), text)
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("  </tbody>\n</table>\n")
+	return b.String(), nil
+}
+
+func htmlAlign(numeric bool) string {
+	if numeric {
+		return ` style="text-align: right"`
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestToMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "array of objects",
+			input: `[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}]`,
+			want:  "| id | name |\n| ---: | --- |\n| 1 | Alice |\n| 2 | Bob |\n",
+		},
+		{
+			name:  "columns from later rows and nulls",
+			input: `[{"a":1},{"a":null,"b":"x"}]`,
+			want:  "| a | b |\n| ---: | --- |\n| 1 |  |\n|  | x |\n",
+		},
+		{
+			name:  "special characters are escaped",
+			input: `[{"s":"a|b *c*\nd"}]`,
+			want:  "| s |\n| --- |\n| a\\|b \\*c\\*<br>d |\n",
+		},
+		{
+			name:  "nested values as inline TOON",
+			input: `[{"tags":["a","b"],"geo":{"lat":1.5,"lng":"x|y"}}]`,
+			want:  "| tags | geo |\n| --- | --- |\n| `[2]: a,b` | `lat: 1.5`<br>`lng: x\\|y` |\n",
+		},
+		{
+			name:  "other values fall back to a code block",
+			input: `{"name":"tq","tags":["a","b"]}`,
+			want:  "```toon\nname: tq\ntags[2]: a,b\n```\n",
+		},
+		{
+			name:  "empty array",
+			input: `[]`,
+			want:  "```toon\n[0]:\n```\n",
+		},
+		{
+			name:    "invalid JSON",
+			input:   `[{`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toMarkdown(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toMarkdown() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("toMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "array of objects",
+			input: `[{"id":1,"name":"<b>","tags":["x"],"geo":{"a":1,"b":2}}]`,
+			want: "<table>\n  <thead>\n    <tr><th style=\"text-align: right\">id</th><th>name</th><th>tags</th><th>geo</th></tr>\n  </thead>\n" +
+				"  <tbody>\n    <tr><td style=\"text-align: right\">1</td><td>&lt;b&gt;</td><td><code>[1]: x</code></td><td><pre>a: 1\nb: 2</pre></td></tr>\n  </tbody>\n</table>\n",
+		},
+		{
+			name:  "other values fall back to a code block",
+			input: `"a < b"`,
+			want:  "<pre><code class=\"language-toon\">a &lt; b</code></pre>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toHTML(tt.input)
+			if err != nil {
+				t.Fatalf("toHTML() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("toHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// tomlValues converts a TOML document to a single JSON object. Tables and
+// inline tables become objects and arrays of tables become arrays of
+// objects, which encode as TOON tabular arrays. Keys keep the order in
+// which they appear in the document.
+//
+// Date and time values become strings: offset datetimes in RFC 3339
+// (1979-05-27T07:32:00-08:00), local datetimes without an offset
+// (1979-05-27T07:32:00), local dates as 1979-05-27 and local times as
+// 07:32:00. Fractional seconds are kept when present. Infinities and NaN,
+// which JSON cannot represent, become null.
+func tomlValues(data []byte) (string, error) {
+	var doc map[string]interface{}
+	meta, err := toml.Decode(string(data), &doc)
+	if err != nil {
+		return "", err
+	}
+
+	// Record the order of the keys under each table. Elements of an array
+	// of tables share the entry of the array itself.
+	order := make(map[string]map[string]int)
+	for _, key := range meta.Keys() {
+		parent := strings.Join(key[:len(key)-1], "\x00")
+		if order[parent] == nil {
+			order[parent] = make(map[string]int)
+		}
+		if _, ok := order[parent][key[len(key)-1]]; !ok {
+			order[parent][key[len(key)-1]] = len(order[parent])
+		}
+	}
+
+	v, err := tomlToValue(doc, nil, order)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// tomlToValue converts a decoded TOML value at path to the value model
+// used by the toon package.
+func tomlToValue(v interface{}, path []string, order map[string]map[string]int) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		rank := order[strings.Join(path, "\x00")]
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// Keys of inline tables inside arrays are not recorded; keep
+		// those sorted so the output is deterministic
+		sort.Slice(keys, func(i, j int) bool {
+			ri, iok := rank[keys[i]]
+			rj, jok := rank[keys[j]]
+			if iok != jok {
+				return iok
+			}
+			if iok && ri != rj {
+				return ri < rj
+			}
+			return keys[i] < keys[j]
+		})
+		obj := toon.NewObject()
+		for _, k := range keys {
+			val, err := tomlToValue(v[k], append(path[:len(path):len(path)], k), order)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(k, val)
+		}
+		return obj, nil
+
+	case []map[string]interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			val, err := tomlToValue(item, path, order)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = val
+		}
+		return arr, nil
+
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			val, err := tomlToValue(item, path, order)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = val
+		}
+		return arr, nil
+
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, nil
+		}
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case time.Time:
+		return tomlTime(v), nil
+	case bool, string:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported TOML value %T", strings.Join(path, "."), v)
+}
+
+// tomlTime formats a TOML date or time value. The decoder marks local
+// values with dedicated time zones so they can be told apart.
+func tomlTime(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "date-local":
+		return t.Format("2006-01-02")
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// toTOML converts one JSON object to a TOML document, keeping key order
+// as far as TOML allows: within each table, plain values come first, then
+// sub-tables and arrays of tables. Small flat tables below the top level
+// are written inline. Arrays of objects become arrays of tables ([[name]])
+// and null fields are left out, since TOML has no null. Strings, including
+// ones that look like dates, are written as strings.
+func toTOML(jsonInput string) (string, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	obj, ok := v.(*toon.Object)
+	if !ok {
+		return "", fmt.Errorf("toml output needs an object, got %s", jsonType(v))
+	}
+	var b strings.Builder
+	if err := writeTOMLTable(&b, nil, obj); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeTOMLTable writes the body of the table at path.
+func writeTOMLTable(b *strings.Builder, path []string, obj *toon.Object) error {
+	var nested []string
+	for _, k := range obj.Keys() {
+		val, _ := obj.Get(k)
+		switch val := val.(type) {
+		case nil:
+			continue
+		case *toon.Object:
+			if val.Len() > 0 && !(len(path) > 0 && tomlFitsInline(k, val)) {
+				nested = append(nested, k)
+				continue
+			}
+		case []interface{}:
+			if isTabular(val) {
+				nested = append(nested, k)
+				continue
+			}
+		}
+		s, err := tomlInline(val)
+		if err != nil {
+			return fmt.Errorf("%s: %v", tomlPath(append(path, k)), err)
+		}
+		fmt.Fprintf(b, "%s = %s\n", tomlKey(k), s)
+	}
+
+	for _, k := range nested {
+		sub := append(path[:len(path):len(path)], k)
+		val, _ := obj.Get(k)
+		if table, ok := val.(*toon.Object); ok {
+			// A table holding only other tables is defined by their headers
+			var body strings.Builder
+			if err := writeTOMLTable(&body, sub, table); err != nil {
+				return err
+			}
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			if !strings.HasPrefix(body.String(), "[") {
+				fmt.Fprintf(b, "[%s]\n", tomlPath(sub))
+			}
+			b.WriteString(body.String())
+			continue
+		}
+		for _, item := range val.([]interface{}) {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(b, "[[%s]]\n", tomlPath(sub))
+			if err := writeTOMLTable(b, sub, item.(*toon.Object)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tomlMaxInline is the longest line written for an inline table.
+const tomlMaxInline = 80
+
+// tomlFitsInline reports whether the table obj, found below the top
+// level, is small and flat enough to be written as an inline table, as in
+// Cargo's `serde = { version = "1.0", features = ["derive"] }`.
+func tomlFitsInline(key string, obj *toon.Object) bool {
+	for _, k := range obj.Keys() {
+		val, _ := obj.Get(k)
+		switch val := val.(type) {
+		case *toon.Object:
+			return false
+		case []interface{}:
+			for _, item := range val {
+				switch item.(type) {
+				case *toon.Object, []interface{}:
+					return false
+				}
+			}
+		}
+	}
+	s, err := tomlInline(obj)
+	return err == nil && len(tomlKey(key))+3+len(s) <= tomlMaxInline
+}
+
+// tomlInline renders a value on a single line, using inline tables for
+// objects nested inside arrays.
+func tomlInline(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", fmt.Errorf("null cannot be written in TOML")
+	case string:
+		return tomlString(v), nil
+	case json.Number:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := tomlInline(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case *toon.Object:
+		if v.Len() == 0 {
+			return "{}", nil
+		}
+		var fields []string
+		for _, k := range v.Keys() {
+			val, _ := v.Get(k)
+			if val == nil {
+				continue
+			}
+			s, err := tomlInline(val)
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, tomlKey(k)+" = "+s)
+		}
+		return "{ " + strings.Join(fields, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("unsupported value %T", v)
+}
+
+// tomlBareKey matches keys that need no quoting.
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+	if tomlBareKey.MatchString(k) {
+		return k
+	}
+	return tomlString(k)
+}
+
+func tomlPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, k := range path {
+		keys[i] = tomlKey(k)
+	}
+	return strings.Join(keys, ".")
+}
+
+// tomlString writes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
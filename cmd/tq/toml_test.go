@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTOMLValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "keys keep their order",
+			input: "zeta = 1\nalpha = 2\n\n[table]\ny = true\nx = \"s\"\n",
+			want:  "{\"zeta\":1,\"alpha\":2,\"table\":{\"y\":true,\"x\":\"s\"}}\n",
+		},
+		{
+			name:  "arrays of tables",
+			input: "[[bin]]\nname = \"b\"\npath = \"src/b.rs\"\n\n[[bin]]\nname = \"a\"\npath = \"src/a.rs\"\n",
+			want:  "{\"bin\":[{\"name\":\"b\",\"path\":\"src/b.rs\"},{\"name\":\"a\",\"path\":\"src/a.rs\"}]}\n",
+		},
+		{
+			name:  "inline tables and dotted keys",
+			input: "serde = { version = \"1.0\", features = [\"derive\"] }\na.b.c = 1\n",
+			want:  "{\"serde\":{\"version\":\"1.0\",\"features\":[\"derive\"]},\"a\":{\"b\":{\"c\":1}}}\n",
+		},
+		{
+			name:  "datetimes become strings",
+			input: "odt = 1979-05-27T07:32:00.5-08:00\nutc = 1979-05-27T07:32:00Z\nldt = 1979-05-27T07:32:00\nld = 1979-05-27\nlt = 07:32:00.25\n",
+			want:  "{\"odt\":\"1979-05-27T07:32:00.5-08:00\",\"utc\":\"1979-05-27T07:32:00Z\",\"ldt\":\"1979-05-27T07:32:00\",\"ld\":\"1979-05-27\",\"lt\":\"07:32:00.25\"}\n",
+		},
+		{
+			name:  "numbers",
+			input: "i = 0x1F\nf = 1.5e3\nbig = 9_007_199_254_740_993\nn = nan\n",
+			want:  "{\"i\":31,\"f\":1500,\"big\":9007199254740993,\"n\":null}\n",
+		},
+		{
+			name:    "invalid TOML",
+			input:   "a = [1, 2\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tomlValues([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tomlValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("tomlValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "values come before tables",
+			input: `{"package":{"name":"demo"},"title":"x","bin":[{"name":"a"},{"name":"b"}]}`,
+			want:  "title = \"x\"\n\n[package]\nname = \"demo\"\n\n[[bin]]\nname = \"a\"\n\n[[bin]]\nname = \"b\"\n",
+		},
+		{
+			name:  "small nested tables are written inline",
+			input: `{"dependencies":{"rand":"0.8","serde":{"version":"1.0","features":["derive"]}}}`,
+			want:  "[dependencies]\nrand = \"0.8\"\nserde = { version = \"1.0\", features = [\"derive\"] }\n",
+		},
+		{
+			name:  "tables holding only tables get no header",
+			input: `{"a":{"b":{"c":{"d":1}}}}`,
+			want:  "[a.b]\nc = { d = 1 }\n",
+		},
+		{
+			name:  "quoted keys, escapes and nulls",
+			input: `{"a b":"say \"hi\"\n","n":null,"list":[{"x":1},2]}`,
+			want:  "\"a b\" = \"say \\\"hi\\\"\\n\"\nlist = [{ x = 1 }, 2]\n",
+		},
+		{
+			name:    "null in an array",
+			input:   `{"a":[1,null]}`,
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			input:   `[1,2]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toTOML(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toTOML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("toTOML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// xlsxSheet is one worksheet: a bold header row followed by data rows.
+type xlsxSheet struct {
+	name   string
+	header []string
+	rows   [][]interface{}
+}
+
+// toXLSX builds a workbook from one JSON value. For an object, each field
+// holding an array of objects becomes a sheet named after the field, and
+// the remaining fields are listed on a "summary" sheet; nested values
+// there are written as inline TOON. An array of objects on its own becomes
+// a single sheet. Numbers and booleans are typed cells.
+func toXLSX(jsonInput string) ([]byte, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	var sheets []*xlsxSheet
+	switch v := v.(type) {
+	case *toon.Object:
+		summary := &xlsxSheet{name: "summary", header: []string{"field", "value"}}
+		for _, k := range v.Keys() {
+			val, _ := v.Get(k)
+			if t := newTable(val); t != nil {
+				sheets = append(sheets, tableSheet(k, t))
+				continue
+			}
+			summary.rows = append(summary.rows, []interface{}{k, val})
+		}
+		if len(summary.rows) > 0 {
+			sheets = append([]*xlsxSheet{summary}, sheets...)
+		}
+	default:
+		t := newTable(v)
+		if t == nil {
+			return nil, fmt.Errorf("xlsx output needs an object or an array of objects, got %s", jsonType(v))
+		}
+		sheets = append(sheets, tableSheet("Sheet1", t))
+	}
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("nothing to write: the object has no fields")
+	}
+	return writeWorkbook(sheets)
+}
+
+// tableSheet lays out a table with the columns of its TOON header.
+func tableSheet(name string, t *table) *xlsxSheet {
+	s := &xlsxSheet{name: name, header: t.columns}
+	for _, row := range t.rows {
+		cells := make([]interface{}, len(t.columns))
+		for i, c := range t.columns {
+			cells[i], _ = row.Get(c)
+		}
+		s.rows = append(s.rows, cells)
+	}
+	return s
+}
+
+// writeWorkbook packages the sheets as an Office Open XML workbook.
+func writeWorkbook(sheets []*xlsxSheet) ([]byte, error) {
+	names := sheetNames(sheets)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name, content string) error {
+		// A fixed timestamp keeps the output reproducible
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(content))
+		return err
+	}
+
+	var types, rels, entries strings.Builder
+	for i := range sheets {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		fmt.Fprintf(&entries, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(names[i]), n, n)
+	}
+	stylesID := len(sheets) + 1
+
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + entries.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() +
+			fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, stylesID) +
+			`</Relationships>`},
+		// Style 1 is the bold header font
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for _, f := range files {
+		if err := add(f.name, f.content); err != nil {
+			return nil, err
+		}
+	}
+	for i, s := range sheets {
+		content, err := sheetXML(s)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %q: %v", names[i], err)
+		}
+		if err := add(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sheetXML renders a worksheet with its header row frozen.
+func sheetXML(s *xlsxSheet) (string, error) {
+	var b strings.Builder
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<sheetData>`)
+
+	b.WriteString(`<row r="1">`)
+	for i, name := range s.header {
+		fmt.Fprintf(&b, `<c r="%s1" s="1" t="inlineStr"><is><t>%s</t></is></c>`, columnName(i), xmlEscape(name))
+	}
+	b.WriteString(`</row>`)
+
+	for r, row := range s.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+2)
+		for i, val := range row {
+			ref := columnName(i) + strconv.Itoa(r+2)
+			switch val := val.(type) {
+			case nil:
+				continue
+			case json.Number:
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, val)
+			case bool:
+				n := 0
+				if val {
+					n = 1
+				}
+				fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, n)
+			default:
+				text, _, err := cell(val)
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(text))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String(), nil
+}
+
+// columnName converts a zero-based column index to A, B, ..., Z, AA, ...
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// sheetNames makes the sheet names valid and unique: at most 31
+// characters, none of []:*?/\, and not empty.
+func sheetNames(sheets []*xlsxSheet) []string {
+	names := make([]string, len(sheets))
+	used := make(map[string]bool)
+	for i, s := range sheets {
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`[]:*?/\`, r) {
+				return '_'
+			}
+			return r
+		}, s.name)
+		name = strings.Trim(name, "'")
+		if name == "" {
+			name = "Sheet" + strconv.Itoa(i+1)
+		}
+		base := truncateRunes(name, 31)
+		name = base
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := fmt.Sprintf(" (%d)", n)
+			name = truncateRunes(base, 31-len(suffix)) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readWorkbook unzips a workbook into a map from part name to content.
+func readWorkbook(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = string(b)
+	}
+	return parts
+}
+
+func TestToXLSX(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		sheets  []string // <sheet> entries of workbook.xml, in order
+		want    map[string][]string
+		wantErr bool
+	}{
+		{
+			name:   "tabular arrays become sheets after the summary",
+			input:  `{"title":"Q3","employees":[{"name":"Ann","age":30,"active":true},{"name":"Bo","age":null,"active":false}],"departments":[{"id":1,"name":"R&D"}]}`,
+			sheets: []string{`name="summary"`, `name="employees"`, `name="departments"`},
+			want: map[string][]string{
+				"xl/worksheets/sheet1.xml": {
+					`<c r="A1" s="1" t="inlineStr"><is><t>field</t></is></c>`,
+					`<c r="B2" t="inlineStr"><is><t xml:space="preserve">Q3</t></is></c>`,
+				},
+				"xl/worksheets/sheet2.xml": {
+					`<c r="B1" s="1" t="inlineStr"><is><t>age</t></is></c>`,
+					`<c r="B2"><v>30</v></c>`,
+					`<c r="C2" t="b"><v>1</v></c>`,
+					`<row r="3"><c r="A3" t="inlineStr"><is><t xml:space="preserve">Bo</t></is></c><c r="C3" t="b"><v>0</v></c></row>`,
+				},
+				"xl/worksheets/sheet3.xml": {
+					`<t xml:space="preserve">R&amp;D</t>`,
+				},
+			},
+		},
+		{
+			name:   "nested summary values as TOON",
+			input:  `{"total":3,"meta":{"a":1,"tags":["x","y"]}}`,
+			sheets: []string{`name="summary"`},
+			want: map[string][]string{
+				"xl/worksheets/sheet1.xml": {
+					`<c r="B2"><v>3</v></c>`,
+					`<t xml:space="preserve">a: 1&#xA;tags[2]: x,y</t>`,
+				},
+			},
+		},
+		{
+			name:   "array of objects",
+			input:  `[{"a":1},{"a":2,"b":"x"}]`,
+			sheets: []string{`name="Sheet1"`},
+			want: map[string][]string{
+				"xl/worksheets/sheet1.xml": {`<c r="B1" s="1" t="inlineStr"><is><t>b</t></is></c>`, `<c r="A3"><v>2</v></c>`},
+			},
+		},
+		{
+			name:   "sheet names are sanitized and unique",
+			input:  `{"a/b":[{"x":1}],"a?b":[{"x":2}],"a_very_long_key_name_that_goes_past_the_limit":[{"x":3}]}`,
+			sheets: []string{`name="a_b"`, `name="a_b (2)"`, `name="a_very_long_key_name_that_goes_"`},
+		},
+		{
+			name:    "scalar",
+			input:   `42`,
+			wantErr: true,
+		},
+		{
+			name:    "empty object",
+			input:   `{}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := toXLSX(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toXLSX() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			parts := readWorkbook(t, data)
+			for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+				if _, ok := parts[name]; !ok {
+					t.Errorf("missing part %s", name)
+				}
+			}
+			workbook := parts["xl/workbook.xml"]
+			if got := strings.Count(workbook, "<sheet "); got != len(tt.sheets) {
+				t.Errorf("got %d sheets, want %d:\n%s", got, len(tt.sheets), workbook)
+			}
+			last := -1
+			for _, s := range tt.sheets {
+				i := strings.Index(workbook, s)
+				if i <= last {
+					t.Errorf("workbook.xml missing %s in order:\n%s", s, workbook)
+				}
+				last = i
+			}
+			for part, fragments := range tt.want {
+				for _, f := range fragments {
+					if !strings.Contains(parts[part], f) {
+						t.Errorf("%s missing %s:\n%s", part, f, parts[part])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestToXLSXDeterministic(t *testing.T) {
+	input := `{"rows":[{"a":1},{"a":2}]}`
+	first, err := toXLSX(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := toXLSX(input)
+	if !bytes.Equal(first, second) {
+		t.Error("toXLSX() output differs between runs")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
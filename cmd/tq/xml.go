@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// maxXMLDepth bounds element nesting so that hostile input fails cleanly.
+const maxXMLDepth = 1000
+
+// xmlValues converts an XML document to a single JSON object, using a
+// convention that --output xml reverses:
+//
+//   - The document becomes an object with a single key, the root element.
+//   - An element with only text becomes its text; an empty element
+//     becomes "".
+//   - Attributes become keys prefixed with "@", written before children.
+//   - Child elements become keys named after the element. Repeated
+//     siblings with the same name become an array, in document order.
+//   - Text next to attributes or child elements is kept under "#text".
+//   - Numbers and booleans are inferred unless --no-infer is given.
+//     Surrounding whitespace is trimmed; comments and processing
+//     instructions are dropped. Namespace prefixes are kept in names
+//     (x:item) and xmlns declarations are ordinary attributes.
+//
+// A single child is not wrapped in an array, so filters that must accept
+// one or many records can use `[.item] | flatten`.
+func xmlValues(data []byte, noInfer bool) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var root *toon.Object
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root != nil {
+				line, _ := dec.InputPos()
+				return "", fmt.Errorf("line %d: document has more than one root element", line)
+			}
+			v, err := xmlElement(dec, t.Copy(), noInfer, 0)
+			if err != nil {
+				return "", err
+			}
+			root = toon.NewObject()
+			root.Set(xmlName(t.Name), v)
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				line, _ := dec.InputPos()
+				return "", fmt.Errorf("line %d: text outside the root element", line)
+			}
+		}
+	}
+	if root == nil {
+		return "", fmt.Errorf("no root element")
+	}
+	b, err := compactJSON(root)
+	if err != nil {
+		return "", err
+	}
+	return b + "\n", nil
+}
+
+// xmlElement reads the content of the element opened by start, up to and
+// including its end tag.
+func xmlElement(dec *xml.Decoder, start xml.StartElement, noInfer bool, depth int) (interface{}, error) {
+	name := xmlName(start.Name)
+	if depth > maxXMLDepth {
+		line, _ := dec.InputPos()
+		return nil, fmt.Errorf("line %d: document nested too deeply", line)
+	}
+
+	obj := toon.NewObject()
+	for _, attr := range start.Attr {
+		obj.Set("@"+xmlName(attr.Name), inferCell(attr.Value, noInfer))
+	}
+	var text strings.Builder
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			return nil, fmt.Errorf("unexpected end of input: <%s> is not closed", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child := xmlName(t.Name)
+			v, err := xmlElement(dec, t.Copy(), noInfer, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			// Elements never decode to arrays, so an array here means the
+			// child has been seen before
+			prev, seen := obj.Get(child)
+			switch prev := prev.(type) {
+			case []interface{}:
+				obj.Set(child, append(prev, v))
+			default:
+				if seen {
+					obj.Set(child, []interface{}{prev, v})
+				} else {
+					obj.Set(child, v)
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if xmlName(t.Name) != name {
+				line, _ := dec.InputPos()
+				return nil, fmt.Errorf("line %d: element <%s> closed by </%s>", line, name, xmlName(t.Name))
+			}
+			s := strings.TrimSpace(text.String())
+			if obj.Len() == 0 {
+				if s == "" {
+					return "", nil
+				}
+				return inferCell(s, noInfer), nil
+			}
+			if s != "" {
+				obj.Set("#text", inferCell(s, noInfer))
+			}
+			return obj, nil
+		}
+	}
+}
+
+// xmlName renders a name with its namespace prefix, as written.
+func xmlName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+// xmlNamePattern matches element and attribute names tq can write.
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][\w.-]*(:[A-Za-z_][\w.-]*)?$`)
+
+// toXML converts one JSON value to an indented XML document. The root
+// element is named root, unless the value is an object with a single
+// element key, which is then used as the root as produced by -I xml.
+// Array elements without a name of their own are written as <item>.
+func toXML(jsonInput, root string) (string, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	if root == "" {
+		root = "root"
+		if obj, ok := v.(*toon.Object); ok && obj.Len() == 1 {
+			k := obj.Keys()[0]
+			val, _ := obj.Get(k)
+			if _, isArray := val.([]interface{}); !isArray && !strings.HasPrefix(k, "@") && k != "#text" {
+				root, v = k, val
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	if err := writeXMLElement(&b, root, v, 0); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeXMLElement writes v as the element name at the given depth.
+func writeXMLElement(b *strings.Builder, name string, v interface{}, depth int) error {
+	if !xmlNamePattern.MatchString(name) {
+		return fmt.Errorf("%q is not a valid XML element name", name)
+	}
+	indent := strings.Repeat("  ", depth)
+
+	var attrs, text string
+	var children []string
+	var values []interface{}
+	switch v := v.(type) {
+	case nil:
+		fmt.Fprintf(b, "%s<%s/>\n", indent, name)
+		return nil
+	case *toon.Object:
+		for _, k := range v.Keys() {
+			val, _ := v.Get(k)
+			switch {
+			case strings.HasPrefix(k, "@"):
+				if !xmlNamePattern.MatchString(k[1:]) {
+					return fmt.Errorf("%q is not a valid XML attribute name", k[1:])
+				}
+				s, err := xmlText(val)
+				if err != nil {
+					return fmt.Errorf("attribute %s: %v", k, err)
+				}
+				attrs += fmt.Sprintf(" %s=\"%s\"", k[1:], xmlEscape(s))
+			case k == "#text":
+				s, err := xmlText(val)
+				if err != nil {
+					return fmt.Errorf("%s/#text: %v", name, err)
+				}
+				text = s
+			default:
+				children = append(children, k)
+				values = append(values, val)
+			}
+		}
+	case []interface{}:
+		// Wrapped so that nested arrays are not spread like object fields
+		for _, item := range v {
+			children = append(children, "item")
+			values = append(values, []interface{}{item})
+		}
+	default:
+		s, err := xmlText(v)
+		if err != nil {
+			return err
+		}
+		text = s
+	}
+
+	if len(children) == 0 {
+		if text == "" {
+			fmt.Fprintf(b, "%s<%s%s/>\n", indent, name, attrs)
+		} else {
+			fmt.Fprintf(b, "%s<%s%s>%s</%s>\n", indent, name, attrs, xmlEscape(text), name)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(b, "%s<%s%s>\n", indent, name, attrs)
+	if text != "" {
+		fmt.Fprintf(b, "%s  %s\n", indent, xmlEscape(text))
+	}
+	for i, child := range children {
+		// Arrays become repeated elements of the same name
+		items, ok := values[i].([]interface{})
+		if !ok {
+			items = []interface{}{values[i]}
+		}
+		for _, item := range items {
+			if err := writeXMLElement(b, child, item, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(b, "%s</%s>\n", indent, name)
+	return nil
+}
+
+// xmlText renders a scalar as text.
+func xmlText(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("nested %s cannot be written as text", jsonType(v))
+}
+
+// xmlEscape escapes text for use in character data or in a double-quoted
+// attribute value.
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestXMLValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		noInfer bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "repeated siblings become an array",
+			input: "<?xml version=\"1.0\"?>\n<feed>\n  <item><id>1</id><name>A</name></item>\n  <item><id>2</id><name>B</name></item>\n</feed>\n",
+			want:  "{\"feed\":{\"item\":[{\"id\":1,\"name\":\"A\"},{\"id\":2,\"name\":\"B\"}]}}\n",
+		},
+		{
+			name:  "attributes and text",
+			input: `<price currency="EUR" sale="true">9.99</price>`,
+			want:  "{\"price\":{\"@currency\":\"EUR\",\"@sale\":true,\"#text\":9.99}}\n",
+		},
+		{
+			name:  "empty elements, entities and CDATA",
+			input: `<a><e/><t>x &amp; y</t><c><![CDATA[<raw>]]></c><z>007</z></a>`,
+			want:  "{\"a\":{\"e\":\"\",\"t\":\"x & y\",\"c\":\"<raw>\",\"z\":\"007\"}}\n",
+		},
+		{
+			name:  "namespace prefixes are kept",
+			input: `<rss xmlns:g="urn:g"><g:id>5</g:id></rss>`,
+			want:  "{\"rss\":{\"@xmlns:g\":\"urn:g\",\"g:id\":5}}\n",
+		},
+		{
+			name:    "no inference",
+			input:   `<a n="1"><b>true</b></a>`,
+			noInfer: true,
+			want:    "{\"a\":{\"@n\":\"1\",\"b\":\"true\"}}\n",
+		},
+		{
+			name:    "mismatched end tag",
+			input:   `<a><b></a>`,
+			wantErr: true,
+		},
+		{
+			name:    "unclosed element",
+			input:   `<a><b></b>`,
+			wantErr: true,
+		},
+		{
+			name:    "two root elements",
+			input:   `<a/><b/>`,
+			wantErr: true,
+		},
+		{
+			name:    "empty input",
+			input:   "<!-- nothing -->",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := xmlValues([]byte(tt.input), tt.noInfer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("xmlValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("xmlValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToXML(t *testing.T) {
+	const header = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"
+	tests := []struct {
+		name    string
+		input   string
+		root    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "single key becomes the root",
+			input: `{"feed":{"@v":2,"item":[{"id":1},{"id":2}],"e":""}}`,
+			want:  header + "<feed v=\"2\">\n  <item>\n    <id>1</id>\n  </item>\n  <item>\n    <id>2</id>\n  </item>\n  <e/>\n</feed>\n",
+		},
+		{
+			name:  "configured root wraps the value",
+			input: `[{"id":1},[2,3]]`,
+			root:  "rows",
+			want:  header + "<rows>\n  <item>\n    <id>1</id>\n  </item>\n  <item>\n    <item>2</item>\n    <item>3</item>\n  </item>\n</rows>\n",
+		},
+		{
+			name:  "default root for other values",
+			input: `{"a":"x < y","b":null}`,
+			want:  header + "<root>\n  <a>x &lt; y</a>\n  <b/>\n</root>\n",
+		},
+		{
+			name:  "text with attributes",
+			input: `{"price":{"@currency":"EUR","#text":9.99}}`,
+			want:  header + "<price currency=\"EUR\">9.99</price>\n",
+		},
+		{
+			name:    "invalid element name",
+			input:   `{"a b":1,"c":2}`,
+			wantErr: true,
+		},
+		{
+			name:    "nested attribute value",
+			input:   `{"a":{"@x":[1]}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toXML(tt.input, tt.root)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toXML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("toXML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/RHEMS-japan/tq/toon"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlValues converts a YAML stream to JSON values, one per line. Each
+// document in a multi-document stream becomes a separate input for the
+// filter. Anchors and aliases are expanded, merge keys (<<) are applied,
+// and mapping keys keep their order.
+func yamlValues(data []byte) (string, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var out strings.Builder
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return out.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		v, err := yamlToValue(&doc, 0)
+		if err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		out.Write(b)
+		out.WriteByte('\n')
+	}
+}
+
+// maxYAMLDepth bounds alias expansion so that self-referencing anchors
+// fail cleanly instead of recursing forever.
+const maxYAMLDepth = 1000
+
+// yamlToValue converts a YAML node to the value model used by the toon
+// package.
+func yamlToValue(n *yaml.Node, depth int) (interface{}, error) {
+	if depth > maxYAMLDepth {
+		return nil, fmt.Errorf("line %d: document nested too deeply (recursive alias?)", n.Line)
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlToValue(n.Content[0], depth+1)
+
+	case yaml.AliasNode:
+		return yamlToValue(n.Alias, depth+1)
+
+	case yaml.SequenceNode:
+		arr := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			v, err := yamlToValue(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+
+	case yaml.MappingNode:
+		// Keys written out explicitly win over keys pulled in with <<
+		explicit := make(map[string]bool)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].ShortTag() != "!!merge" {
+				explicit[resolveAlias(n.Content[i]).Value] = true
+			}
+		}
+
+		obj := toon.NewObject()
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.ShortTag() == "!!merge" {
+				if err := mergeYAML(obj, value, explicit, depth+1); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			v, err := yamlToValue(value, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(resolveAlias(key).Value, v)
+		}
+		return obj, nil
+	}
+	return yamlScalar(n)
+}
+
+// mergeYAML applies a merge key: value is a mapping, or a sequence of
+// mappings where earlier ones take precedence.
+func mergeYAML(obj *toon.Object, value *yaml.Node, explicit map[string]bool, depth int) error {
+	value = resolveAlias(value)
+	sources := []*yaml.Node{value}
+	if value.Kind == yaml.SequenceNode {
+		sources = value.Content
+	}
+	for _, src := range sources {
+		v, err := yamlToValue(src, depth)
+		if err != nil {
+			return err
+		}
+		m, ok := v.(*toon.Object)
+		if !ok {
+			return fmt.Errorf("line %d: merge key (<<) requires a mapping", src.Line)
+		}
+		for _, k := range m.Keys() {
+			if _, exists := obj.Get(k); exists || explicit[k] {
+				continue
+			}
+			val, _ := m.Get(k)
+			obj.Set(k, val)
+		}
+	}
+	return nil
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// yamlScalar converts a scalar using its resolved tag. Timestamps and
+// binary data stay strings; infinities and NaN, which JSON cannot
+// represent, become null.
+func yamlScalar(n *yaml.Node) (interface{}, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	case "!!int", "!!float":
+		if jsonNumber.MatchString(n.Value) {
+			return json.Number(n.Value), nil
+		}
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case int:
+			return json.Number(strconv.Itoa(v)), nil
+		case int64:
+			return json.Number(strconv.FormatInt(v, 10)), nil
+		case uint64:
+			return json.Number(strconv.FormatUint(v, 10)), nil
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, nil
+			}
+			return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+		}
+		return n.Value, nil
+	}
+	return n.Value, nil
+}
+
+// toYAML converts one JSON value to a YAML document, keeping key order.
+func toYAML(jsonInput string) (string, error) {
+	v, err := toon.DecodeJSON([]byte(jsonInput))
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(valueToYAML(v)); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// valueToYAML builds a YAML node tree for a decoded JSON value.
+func valueToYAML(v interface{}) *yaml.Node {
+	switch v := v.(type) {
+	case *toon.Object:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, k := range v.Keys() {
+			val, _ := v.Get(k)
+			n.Content = append(n.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k},
+				valueToYAML(val))
+		}
+		return n
+	case []interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			n.Content = append(n.Content, valueToYAML(item))
+		}
+		return n
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(string(v), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(v)}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+}
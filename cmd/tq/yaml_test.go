@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestYAMLValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "keys keep their order",
+			input: "zeta: 1\nalpha: 2\nmid: 3\n",
+			want:  "{\"zeta\":1,\"alpha\":2,\"mid\":3}\n",
+		},
+		{
+			name:  "multiple documents",
+			input: "a: 1\n---\na: 2\n",
+			want:  "{\"a\":1}\n{\"a\":2}\n",
+		},
+		{
+			name:  "anchors and aliases are expanded",
+			input: "base: &b\n  x: 1\ncopy: *b\nlist: [*b, *b]\n",
+			want:  "{\"base\":{\"x\":1},\"copy\":{\"x\":1},\"list\":[{\"x\":1},{\"x\":1}]}\n",
+		},
+		{
+			name:  "merge keys do not override explicit keys",
+			input: "d: &d {a: 1, b: 2}\ne:\n  b: 3\n  <<: *d\n",
+			want:  "{\"d\":{\"a\":1,\"b\":2},\"e\":{\"b\":3,\"a\":1}}\n",
+		},
+		{
+			name:  "scalar types",
+			input: "s: hello\nq: \"42\"\ni: 42\nh: 0x1F\nf: 1.50\nb: true\nn: ~\nt: 2024-01-01\ninf: .inf\n",
+			want:  "{\"s\":\"hello\",\"q\":\"42\",\"i\":42,\"h\":31,\"f\":1.50,\"b\":true,\"n\":null,\"t\":\"2024-01-01\",\"inf\":null}\n",
+		},
+		{
+			name:  "sequence of mappings",
+			input: "- name: a\n  port: 80\n- name: b\n  port: 443\n",
+			want:  "[{\"name\":\"a\",\"port\":80},{\"name\":\"b\",\"port\":443}]\n",
+		},
+		{
+			name:  "empty input",
+			input: "",
+			want:  "",
+		},
+		{
+			name:    "invalid YAML",
+			input:   "a: [1, 2\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := yamlValues([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("yamlValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("yamlValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "object keeps key order",
+			input: `{"zeta":1,"alpha":"x"}`,
+			want:  "zeta: 1\nalpha: x\n",
+		},
+		{
+			name:  "strings that look like other types are quoted",
+			input: `{"a":"true","b":"42","c":"null"}`,
+			want:  "a: \"true\"\nb: \"42\"\nc: \"null\"\n",
+		},
+		{
+			name:  "nested structures",
+			input: `{"spec":{"ports":[{"name":"http","port":80}],"tags":[],"meta":{}}}`,
+			want:  "spec:\n  ports:\n    - name: http\n      port: 80\n  tags: []\n  meta: {}\n",
+		},
+		{
+			name:  "scalar result",
+			input: `"hello"`,
+			want:  "hello\n",
+		},
+		{
+			name:    "invalid JSON",
+			input:   `{invalid}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toYAML(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toYAML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("toYAML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,3 +1,7 @@
 module github.com/RHEMS-japan/tq
 
 go 1.21
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/BurntSushi/toml v1.5.0
@@ -0,0 +1,146 @@
+//go:build ignore
+
+// gen.go trains the embedded vocabulary, tq-bpe.tiktoken, on the corpus
+// in testdata/corpus: a fixed copy of the documentation and of the sample
+// data, which is written as TOON, compact JSON and pretty JSON. The corpus
+// is pinned so that edits elsewhere in the repository do not change the
+// vocabulary. Run it with `go generate ./tokenizer`; -o writes the
+// vocabulary to another file.
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/RHEMS-japan/tq/tokenizer"
+	"github.com/RHEMS-japan/tq/toon"
+)
+
+// vocabSize is the number of tokens to train, including the 256 bytes.
+const vocabSize = 4096
+
+func main() {
+	output := flag.String("o", "tq-bpe.tiktoken", "file to write the vocabulary to")
+	flag.Parse()
+
+	corpus, err := readCorpus()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Count each distinct piece once, weighted by how often it occurs
+	freq := make(map[string]int)
+	for _, text := range corpus {
+		for _, piece := range tokenizer.Split(text) {
+			freq[piece]++
+		}
+	}
+	type word struct {
+		parts []string
+		count int
+	}
+	words := make([]*word, 0, len(freq))
+	for piece, n := range freq {
+		w := &word{count: n}
+		for i := 0; i < len(piece); i++ {
+			w.parts = append(w.parts, piece[i:i+1])
+		}
+		words = append(words, w)
+	}
+
+	var tokens []string
+	for c := 0; c < 256; c++ {
+		tokens = append(tokens, string([]byte{byte(c)}))
+	}
+	for len(tokens) < vocabSize {
+		pairs := make(map[[2]string]int)
+		for _, w := range words {
+			for i := 0; i+1 < len(w.parts); i++ {
+				pairs[[2]string{w.parts[i], w.parts[i+1]}] += w.count
+			}
+		}
+		var best [2]string
+		bestCount := 0
+		for p, n := range pairs {
+			if n > bestCount || (n == bestCount && p[0]+"\x00"+p[1] < best[0]+"\x00"+best[1]) {
+				best, bestCount = p, n
+			}
+		}
+		if bestCount < 2 {
+			break
+		}
+		merged := best[0] + best[1]
+		tokens = append(tokens, merged)
+		for _, w := range words {
+			out := w.parts[:0]
+			for i := 0; i < len(w.parts); i++ {
+				if i+1 < len(w.parts) && w.parts[i] == best[0] && w.parts[i+1] == best[1] {
+					out = append(out, merged)
+					i++
+					continue
+				}
+				out = append(out, w.parts[i])
+			}
+			w.parts = out
+		}
+	}
+
+	var b strings.Builder
+	for rank, tok := range tokens {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), rank)
+	}
+	if err := os.WriteFile(*output, []byte(b.String()), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d tokens", len(tokens))
+}
+
+// readCorpus returns the training texts.
+func readCorpus() ([]string, error) {
+	var corpus []string
+	for _, name := range []string{"testdata/corpus/README.md", "testdata/corpus/EXAMPLES.md"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		corpus = append(corpus, string(data))
+	}
+	samples, err := filepath.Glob("testdata/corpus/*.toon")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(samples)
+	for _, name := range samples {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		corpus = append(corpus, string(data))
+		v, err := toon.Decode(data)
+		if err != nil {
+			log.Printf("%s: %v (using the text only)", name, err)
+			continue
+		}
+		encoded, err := toon.Encode(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		compact, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		pretty, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		corpus = append(corpus, encoded, string(compact), string(pretty))
+	}
+	return corpus, nil
+}
@@ -0,0 +1,277 @@
+// Package tokenizer counts the tokens a language model would see in a
+// piece of text. It implements byte-level BPE in the style of tiktoken,
+// with an embedded vocabulary so that counts work offline, and a simple
+// heuristic for when no vocabulary fits.
+//
+// The embedded vocabulary is not any model's: it is small and trained on
+// tq's own documentation, so its counts are approximate. Load a model's
+// published vocabulary, such as cl100k_base.tiktoken, for exact counts.
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts tokens.
+type Tokenizer interface {
+	// Name identifies the vocabulary in reports.
+	Name() string
+	// Count returns the number of tokens in s.
+	Count(s string) int
+}
+
+// DefaultName is the name of the embedded vocabulary.
+const DefaultName = "tq-bpe"
+
+// HeuristicName selects the heuristic tokenizer.
+const HeuristicName = "heuristic"
+
+//go:generate go run gen.go
+
+// embeddedVocab is a byte-level BPE vocabulary trained on JSON, TOON and
+// English text by gen.go, in tiktoken's format.
+//
+//go:embed tq-bpe.tiktoken
+var embeddedVocab []byte
+
+var (
+	defaultOnce sync.Once
+	defaultBPE  *BPE
+	defaultErr  error
+)
+
+// Default returns the tokenizer for the embedded vocabulary.
+func Default() (*BPE, error) {
+	defaultOnce.Do(func() {
+		defaultBPE, defaultErr = Load(bytes.NewReader(embeddedVocab), DefaultName)
+	})
+	return defaultBPE, defaultErr
+}
+
+// Get returns a tokenizer by name: DefaultName, HeuristicName, or the path
+// of a tiktoken vocabulary file such as cl100k_base.tiktoken, which gives
+// the counts of the models that use it.
+func Get(name string) (Tokenizer, error) {
+	switch name {
+	case "", DefaultName:
+		return Default()
+	case HeuristicName:
+		return Heuristic{}, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	base := name[strings.LastIndexAny(name, `/\`)+1:]
+	return Load(f, strings.TrimSuffix(base, ".tiktoken"))
+}
+
+// BPE is a byte-level byte-pair-encoding tokenizer. Text is first split
+// into pieces (words, numbers, punctuation and whitespace runs), and each
+// piece is then merged from single bytes into the lowest-ranked tokens of
+// the vocabulary.
+type BPE struct {
+	name  string
+	ranks map[string]int
+}
+
+// Load reads a vocabulary in tiktoken's format: one token per line, as
+// base64 followed by its rank. Every single byte must be a token.
+func Load(r io.Reader, name string) (*BPE, error) {
+	b := &BPE{name: name, ranks: make(map[string]int)}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		tok, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s: line %d: expected a token and a rank", name, line)
+		}
+		data, err := base64.StdEncoding.DecodeString(tok)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: invalid token: %v", name, line, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: invalid rank %q", name, line, rank)
+		}
+		b.ranks[string(data)] = n
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for c := 0; c < 256; c++ {
+		if _, ok := b.ranks[string([]byte{byte(c)})]; !ok {
+			return nil, fmt.Errorf("%s: not a byte-level vocabulary (byte %#x has no token)", name, c)
+		}
+	}
+	return b, nil
+}
+
+// Name returns the vocabulary name.
+func (b *BPE) Name() string {
+	return b.name
+}
+
+// Size returns the number of tokens in the vocabulary.
+func (b *BPE) Size() int {
+	return len(b.ranks)
+}
+
+// Count returns the number of tokens in s.
+func (b *BPE) Count(s string) int {
+	n := 0
+	for _, piece := range Split(s) {
+		n += b.countPiece(piece)
+	}
+	return n
+}
+
+// countPiece merges the bytes of piece pairwise, always merging the pair
+// whose result has the lowest rank, until no adjacent pair is a token.
+func (b *BPE) countPiece(piece string) int {
+	if _, ok := b.ranks[piece]; ok {
+		return 1
+	}
+	// bounds[i] is the start of the i-th part; the last entry is len(piece)
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// Heuristic estimates about one token per four characters of each piece,
+// and at least one per piece.
+type Heuristic struct{}
+
+// Name returns HeuristicName.
+func (Heuristic) Name() string {
+	return HeuristicName
+}
+
+// Count returns the estimated number of tokens in s.
+func (Heuristic) Count(s string) int {
+	n := 0
+	for _, piece := range Split(s) {
+		n += (utf8.RuneCountInString(piece) + 3) / 4
+	}
+	return n
+}
+
+// Split divides s into the pieces that BPE merges independently, following
+// the pre-tokenization rules of cl100k_base: English contractions, words
+// with an optional leading space or symbol, numbers of up to three digits,
+// runs of punctuation with an optional leading space, and whitespace.
+// Whitespace before a word stays with the word.
+func Split(s string) []string {
+	var pieces []string
+	for i := 0; i < len(s); {
+		n := pieceLen(s[i:])
+		pieces = append(pieces, s[i:i+n])
+		i += n
+	}
+	return pieces
+}
+
+// pieceLen returns the length in bytes of the piece at the start of s.
+func pieceLen(s string) int {
+	r, size := utf8.DecodeRuneInString(s)
+	next, nextSize := utf8.DecodeRuneInString(s[size:])
+	hasNext := nextSize > 0
+
+	// Contractions: 's 't 're 've 'm 'll 'd
+	if r == '\'' {
+		lower := strings.ToLower(s[1:min(len(s), 3)])
+		for _, c := range []string{"re", "ve", "ll", "s", "t", "m", "d"} {
+			if strings.HasPrefix(lower, c) {
+				return 1 + len(c)
+			}
+		}
+	}
+
+	// Letters, optionally after one character that is not a letter, digit
+	// or line break
+	if unicode.IsLetter(r) {
+		return size + runLen(s[size:], unicode.IsLetter, -1)
+	}
+	if hasNext && unicode.IsLetter(next) && r != '\r' && r != '\n' && !unicode.IsNumber(r) {
+		return size + nextSize + runLen(s[size+nextSize:], unicode.IsLetter, -1)
+	}
+
+	// Up to three digits
+	if unicode.IsNumber(r) {
+		return size + runLen(s[size:], unicode.IsNumber, 2)
+	}
+
+	// Punctuation, optionally after a space, followed by line breaks
+	start := 0
+	if r == ' ' && hasNext && isPunct(next) {
+		start = size
+	}
+	if p, psize := utf8.DecodeRuneInString(s[start:]); isPunct(p) {
+		n := start + psize + runLen(s[start+psize:], isPunct, -1)
+		return n + runLen(s[n:], isLineBreak, -1)
+	}
+
+	// Whitespace: through the last line break of the run, or the run
+	// without its final character if a non-space follows it
+	n := size + runLen(s[size:], unicode.IsSpace, -1)
+	if last := strings.LastIndexAny(s[:n], "\r\n"); last >= 0 {
+		return last + 1
+	}
+	if n < len(s) && n > size {
+		_, lastSize := utf8.DecodeLastRuneInString(s[:n])
+		return n - lastSize
+	}
+	return n
+}
+
+// runLen returns the length in bytes of the leading runes of s that
+// satisfy f, stopping after max runes when max >= 0.
+func runLen(s string, f func(rune) bool, max int) int {
+	n, count := 0, 0
+	for n < len(s) && count != max {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !f(r) {
+			break
+		}
+		n += size
+		count++
+	}
+	return n
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func isLineBreak(r rune) bool {
+	return r == '\r' || r == '\n'
+}
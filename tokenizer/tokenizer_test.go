@@ -0,0 +1,190 @@
+package tokenizer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"hello world", []string{"hello", " world"}},
+		{"I'm here, they've gone", []string{"I", "'m", " here", ",", " they", "'ve", " gone"}},
+		{"id: 12345", []string{"id", ":", " ", "123", "45"}},
+		{`{"a":1}`, []string{`{"`, "a", `":`, "1", "}"}},
+		{"users[2]{id,name}:\n  1,Alice", []string{"users", "[", "2", "]{", "id", ",name", "}:\n", " ", " ", "1", ",Alice"}},
+		{"a  \n\n  b", []string{"a", "  \n\n", " ", " b"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := Split(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			if strings.Join(got, "") != tt.input {
+				t.Errorf("Split(%q) pieces do not add up to the input", tt.input)
+			}
+		})
+	}
+}
+
+// vocab builds a tiktoken file with every single byte followed by merges,
+// ranked in order.
+func vocab(merges ...string) string {
+	var b strings.Builder
+	rank := 0
+	for c := 0; c < 256; c++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(c)}), rank)
+		rank++
+	}
+	for _, m := range merges {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(m)), rank)
+		rank++
+	}
+	return b.String()
+}
+
+func TestBPECount(t *testing.T) {
+	b, err := Load(strings.NewReader(vocab("ab", "cd", "abcd", " ab")), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name() != "test" || b.Size() != 260 {
+		t.Fatalf("Load() = %s with %d tokens", b.Name(), b.Size())
+	}
+
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"abab", 2},
+		{"acbd", 4},
+		{"ab ab", 2},
+		{"ab, cd", 4},
+	}
+	for _, tt := range tests {
+		if got := b.Count(tt.input); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"missing rank", "YQ==\n", "test: line 1: expected a token and a rank"},
+		{"invalid base64", "!!! 1\n", "test: line 1: invalid token"},
+		{"invalid rank", "YQ== x\n", `test: line 1: invalid rank "x"`},
+		{"missing bytes", "YQ== 0\n", "test: not a byte-level vocabulary (byte 0x0 has no token)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(strings.NewReader(tt.input), "test")
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	b, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name() != DefaultName || b.Size() <= 256 {
+		t.Fatalf("Default() = %s with %d tokens", b.Name(), b.Size())
+	}
+
+	// TOON spends fewer tokens than JSON on the same rows
+	toon := "users[2]{id,name}:\n  1,Alice\n  2,Bob\n"
+	json := `{"users":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}]}`
+	if b.Count(toon) >= b.Count(json) {
+		t.Errorf("Count(TOON) = %d, want less than Count(JSON) = %d", b.Count(toon), b.Count(json))
+	}
+	if n := b.Count(json); n >= len(json) {
+		t.Errorf("Count(JSON) = %d, want fewer tokens than bytes (%d)", n, len(json))
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "", want: DefaultName},
+		{name: DefaultName, want: DefaultName},
+		{name: HeuristicName, want: HeuristicName},
+		{name: "testdata/missing.tiktoken", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Get(tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Get(%q) succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Get(%q) error = %v", tt.name, err)
+			continue
+		}
+		if got.Name() != tt.want {
+			t.Errorf("Get(%q).Name() = %q, want %q", tt.name, got.Name(), tt.want)
+		}
+	}
+}
+
+func TestHeuristic(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"hello", 2},
+		{"hello world", 4},
+		{`{"a":1}`, 5},
+	}
+	for _, tt := range tests {
+		if got := (Heuristic{}).Count(tt.input); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestEmbeddedVocabMatchesGenerator(t *testing.T) {
+	if testing.Short() {
+		t.Skip("training the vocabulary takes several seconds")
+	}
+	out := filepath.Join(t.TempDir(), "vocab.tiktoken")
+	cmd := exec.Command("go", "run", "gen.go", "-o", out)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go run gen.go: %v\n%s", err, msg)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, embeddedVocab) {
+		t.Error("tq-bpe.tiktoken differs from the output of gen.go; run go generate ./tokenizer")
+	}
+}
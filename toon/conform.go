@@ -0,0 +1,156 @@
+package toon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// lengthName matches the names a template may give an array length, as
+// in results[N] or rows[*].
+var lengthName = regexp.MustCompile(`^(?:\*|[A-Za-z_][A-Za-z0-9_]*)$`)
+
+// typeNames are the values that stand for any value of a type in a
+// template.
+var typeNames = map[string]bool{"any": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true}
+
+// ParseTemplate reads a shape template for Conform. A template is a TOON
+// document written like the output it describes, except that:
+//
+//   - array lengths are ignored and may be a name, as in results[N]
+//   - a tabular header without rows, such as results[N]{id,title,score}:,
+//     accepts rows with those fields and values of any type
+//   - a value may be a type name instead of an example: string, number,
+//     integer, boolean, null or any
+func ParseTemplate(data []byte) (interface{}, error) {
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.p.template = true
+	return decode(dec)
+}
+
+// placeholderRow fills the tabular array of a template that has no rows
+// with a row of the type name any for each field.
+func (p *parser) placeholderRow(f *frame) {
+	if len(f.fields) == 0 {
+		p.leaf(f.path, []interface{}{})
+		return
+	}
+	row := appendPath(f.path, 0)
+	for _, name := range f.fields {
+		p.leaf(appendPath(row, name), "any")
+	}
+	p.emit(Event{Path: appendPath(row, f.fields[len(f.fields)-1]), Closing: true})
+	p.emit(Event{Path: row, Closing: true})
+}
+
+// Mismatch is a difference between a value and its template.
+type Mismatch struct {
+	Path string // jq path such as .results[2].score
+	Msg  string
+}
+
+func (m Mismatch) String() string {
+	return m.Path + ": " + m.Msg
+}
+
+// Conform checks that v has the shape of template, as read by
+// ParseTemplate or DecodeJSON, and returns the differences in document
+// order. Objects must have the same keys, in any order. Every item of an
+// array must match the template's first item, and an empty template
+// array accepts any items. Primitives must have the same type as the
+// template's example or type name; values are not compared.
+func Conform(template, v interface{}) []Mismatch {
+	var mismatches []Mismatch
+	conform(".", template, v, &mismatches)
+	return mismatches
+}
+
+func conform(path string, want, got interface{}, out *[]Mismatch) {
+	mismatch := func(path, format string, args ...interface{}) {
+		*out = append(*out, Mismatch{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	switch want := want.(type) {
+	case *Object:
+		obj, ok := got.(*Object)
+		if !ok {
+			mismatch(path, "expected object, got %s", typeName(got))
+			return
+		}
+		for _, k := range want.Keys() {
+			wantVal, _ := want.Get(k)
+			if gotVal, ok := obj.Get(k); ok {
+				conform(FieldPath(path, k), wantVal, gotVal, out)
+			} else {
+				mismatch(FieldPath(path, k), "missing key")
+			}
+		}
+		for _, k := range obj.Keys() {
+			if _, ok := want.Get(k); !ok {
+				mismatch(FieldPath(path, k), "unexpected key")
+			}
+		}
+	case []interface{}:
+		arr, ok := got.([]interface{})
+		if !ok {
+			mismatch(path, "expected array, got %s", typeName(got))
+			return
+		}
+		if len(want) == 0 {
+			return
+		}
+		for i, item := range arr {
+			conform(indexPath(path, i), want[0], item, out)
+		}
+	default:
+		wantType := typeName(want)
+		if s, ok := want.(string); ok && typeNames[s] {
+			wantType = s
+		}
+		gotType := typeName(got)
+		switch {
+		case wantType == "any", wantType == gotType:
+		case wantType == "integer" && gotType == "number" && isInteger(got):
+		default:
+			mismatch(path, "expected %s, got %s", wantType, gotType)
+		}
+	}
+}
+
+// typeName returns the JSON type of a decoded value.
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case *Object, map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "number"
+}
+
+// isInteger reports whether a number is written without a fraction or
+// exponent.
+func isInteger(v interface{}) bool {
+	switch v := v.(type) {
+	case json.Number:
+		return !strings.ContainsAny(string(v), ".eE")
+	case float64:
+		return v == float64(int64(v))
+	}
+	return true
+}
+
+func indexPath(path string, i int) string {
+	if path == "." {
+		return fmt.Sprintf(".[%d]", i)
+	}
+	return fmt.Sprintf("%s[%d]", path, i)
+}
@@ -0,0 +1,108 @@
+package toon
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "named length and header without rows",
+			input: "query: string\nresults[N]{id,title,score}:",
+			want:  `{"query":"string","results":[{"id":"any","title":"any","score":"any"}]}`,
+		},
+		{
+			name:  "lengths are ignored",
+			input: "results[5]{id,score}:\n  integer,number\ntags[*]: string\nitems[3]:\n  - a",
+			want:  `{"results":[{"id":"integer","score":"number"}],"tags":["string"],"items":["a"]}`,
+		},
+		{
+			name:  "empty list",
+			input: "tags[n]:",
+			want:  `{"tags":[]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := ParseTemplate([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("ParseTemplate() error = %v", err)
+			}
+			got, _ := json.Marshal(v)
+			if string(got) != tt.want {
+				t.Errorf("ParseTemplate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseTemplate([]byte("rows[-1]:")); err == nil {
+		t.Error("ParseTemplate() accepted a negative length")
+	}
+}
+
+func TestConform(t *testing.T) {
+	template := "query: string\ncount: integer\nresults[N]{id,title,score}:\n  1,Example,0.5\ntags[N]:\nmeta:\n  done: boolean\n  extra: any"
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "matching reply with another row count",
+			input: "query: cats\ncount: 3\nresults[3]{title,id,score}:\n  A,1,0.9\n  B,2,1\n  C,3,0.1\ntags[2]: x,7\nmeta:\n  extra[1]: 1\n  done: true",
+		},
+		{
+			name:  "path-level mismatches",
+			input: "query: 42\ncount: 2.5\nresults[2]{id,title}:\n  1,A\n  2,B\nrank: 1\ntags: none\nmeta:\n  done: null\n  extra: null",
+			want: []string{
+				".query: expected string, got number",
+				".count: expected integer, got number",
+				".results[0].score: missing key",
+				".results[1].score: missing key",
+				".tags: expected array, got string",
+				".meta.done: expected boolean, got null",
+				".rank: unexpected key",
+			},
+		},
+		{
+			name:  "list items and wrong fields",
+			input: "query: q\ncount: 1\nresults[1]:\n  - id: x\n    title: T\n    score: 1\n    \"extra field\": 2\ntags[0]:\nmeta: 3",
+			want: []string{
+				".results[0].id: expected number, got string",
+				`.results[0]["extra field"]: unexpected key`,
+				".meta: expected object, got number",
+			},
+		},
+	}
+
+	want, err := ParseTemplate([]byte(template))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Decode([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range Conform(want, v) {
+				got = append(got, m.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Conform() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	if got := Conform([]interface{}{json.Number("1")}, []interface{}{"a"}); len(got) != 1 || got[0].Path != ".[0]" {
+		t.Errorf("Conform() on a root array = %v", got)
+	}
+}
@@ -0,0 +1,656 @@
+package toon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// indentSize is the number of spaces per nesting level.
+const indentSize = 2
+
+// numberPattern matches unquoted tokens that decode as numbers. Tokens with
+// leading zeros such as "007" stay strings.
+var numberPattern = regexp.MustCompile(`^-?(?:0|[1-9]\d*)(?:\.\d+)?(?:[eE][+-]?\d+)?$`)
+
+// SyntaxError describes malformed TOON input.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Decoder reads TOON text incrementally and reports its contents as path
+// events. Only the current line and the chain of open containers are kept
+// in memory, so documents larger than RAM can be processed. The comment
+// lines that EncodeOptions.MaxItems leaves in place of trimmed elements,
+// such as `# 4,812 more rows omitted`, are skipped.
+type Decoder struct {
+	r     *bufio.Reader
+	p     *parser
+	queue []Event
+	err   error
+	held  []string // lines read ahead by a lenient decoder
+}
+
+// NewDecoder returns a Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	d := &Decoder{r: bufio.NewReader(r)}
+	d.p = &parser{emit: func(ev Event) { d.queue = append(d.queue, ev) }}
+	return d
+}
+
+// Next returns the next event. It returns io.EOF once the document has
+// been fully read.
+func (d *Decoder) Next() (Event, error) {
+	for len(d.queue) == 0 {
+		if d.err != nil {
+			return Event{}, d.err
+		}
+		line, err := d.r.ReadString('\n')
+		if d.p.lenient {
+			d.readAhead(line, err == io.EOF)
+		} else if len(line) > 0 {
+			if perr := d.p.feed(line); perr != nil {
+				d.err = perr
+				continue
+			}
+		}
+		if err == io.EOF {
+			d.err = io.EOF
+			if perr := d.p.end(); perr != nil {
+				d.err = perr
+			}
+		} else if err != nil {
+			d.err = err
+		}
+	}
+	ev := d.queue[0]
+	d.queue = d.queue[1:]
+	return ev, nil
+}
+
+// Decode parses a complete TOON document.
+func Decode(data []byte) (interface{}, error) {
+	return decode(NewDecoder(bytes.NewReader(data)))
+}
+
+// decode builds the value read by dec.
+func decode(dec *Decoder) (interface{}, error) {
+	var b Builder
+	var result interface{}
+	for {
+		ev, err := dec.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		v, done, err := b.Push(ev)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			result = v
+		}
+	}
+}
+
+type frameKind int
+
+const (
+	objectFrame frameKind = iota
+	listFrame
+	tableFrame
+)
+
+// frame is an open container whose child lines are expected at depth.
+type frame struct {
+	kind   frameKind
+	depth  int
+	path   []interface{}
+	last   interface{} // key or index of the most recent child
+	count  int
+	length int // declared length, for list and table frames, or -1 for any
+	delim  byte
+	fields []string
+}
+
+// pendingKey is a `key:` line without a value. Whether it opens a nested
+// object or denotes an empty one depends on the indentation of the next
+// line.
+type pendingKey struct {
+	path  []interface{}
+	depth int
+}
+
+// parser is the line-driven state machine behind Decoder.
+type parser struct {
+	emit    func(Event)
+	line    int
+	stack   []*frame
+	pending *pendingKey
+	started bool
+	done    bool // a root primitive has been read
+
+	// Lenient decoding, see NewLenientDecoder
+	lenient bool
+	final   bool  // the line being fed is the last one
+	levels  []int // indentation of the enclosing lines, in columns
+	repairs []Repair
+
+	template bool // array lengths are ignored, see ParseTemplate
+
+	// rows, if set, receives each tabular row as one object instead of
+	// its leaf events, see PushDecoder
+	rows func(path []interface{}, row *Object)
+}
+
+// header is a parsed array header such as `[3|]{id,name}:`.
+type header struct {
+	length int
+	delim  byte
+	fields []string
+	inline string
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// feed processes one line of input, with or without its line terminator.
+func (p *parser) feed(raw string) error {
+	p.line++
+	raw = strings.TrimRight(raw, "\r\n")
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	if omittedMarker.MatchString(strings.TrimSpace(raw)) {
+		// Stands in for elements left out by EncodeOptions.MaxItems
+		if p.lenient {
+			p.repair("skipped", "", "skipped line: comment marking omitted elements")
+		}
+		return nil
+	}
+
+	indent := 0
+	for indent < len(raw) && raw[indent] == ' ' {
+		indent++
+	}
+	var depth int
+	if p.lenient {
+		indent, depth = p.level(raw)
+	} else {
+		if raw[indent] == '\t' {
+			return p.errorf("tab characters are not allowed in indentation")
+		}
+		if indent%indentSize != 0 {
+			return p.errorf("indentation must be a multiple of %d spaces", indentSize)
+		}
+		depth = indent / indentSize
+	}
+	content := raw[indent:]
+
+	if p.done {
+		return p.errorf("unexpected content after root value")
+	}
+	if !p.started {
+		p.started = true
+		return p.root(depth, content)
+	}
+
+	if pk := p.pending; pk != nil {
+		p.pending = nil
+		if depth > pk.depth {
+			p.stack = append(p.stack, &frame{kind: objectFrame, depth: pk.depth + 1, path: pk.path})
+		} else {
+			p.leaf(pk.path, NewObject())
+		}
+	}
+
+	for len(p.stack) > 0 && p.stack[len(p.stack)-1].depth > depth {
+		if err := p.pop(); err != nil {
+			return err
+		}
+	}
+	if len(p.stack) == 0 {
+		return p.errorf("unexpected content after root value")
+	}
+	top := p.stack[len(p.stack)-1]
+	if depth != top.depth {
+		if !p.lenient {
+			return p.errorf("unexpected indentation")
+		}
+		p.repair("indentation", "", "line is indented deeper than its parent's other children")
+	}
+
+	switch top.kind {
+	case listFrame:
+		return p.item(top, content)
+	case tableFrame:
+		return p.row(top, content)
+	default:
+		return p.field(top, content)
+	}
+}
+
+// end flushes all open containers once the input is exhausted.
+func (p *parser) end() error {
+	if !p.started {
+		p.leaf(nil, NewObject())
+		return nil
+	}
+	if pk := p.pending; pk != nil {
+		p.pending = nil
+		p.leaf(pk.path, NewObject())
+	}
+	for len(p.stack) > 0 {
+		if err := p.pop(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// root decides from the first line whether the document is an object, an
+// array or a single primitive.
+func (p *parser) root(depth int, content string) error {
+	if depth != 0 {
+		return p.errorf("unexpected indentation")
+	}
+	if content[0] == '[' {
+		return p.header(nil, 0, content)
+	}
+	if unquotedIndex(content, ':') >= 0 {
+		f := &frame{kind: objectFrame}
+		p.stack = append(p.stack, f)
+		return p.field(f, content)
+	}
+	v, err := p.primitive(content)
+	if err != nil {
+		return err
+	}
+	p.leaf(nil, v)
+	p.done = true
+	return nil
+}
+
+// pop closes the innermost container.
+func (p *parser) pop() error {
+	f := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	if f.kind != objectFrame && f.length >= 0 && f.count != f.length {
+		if !p.lenient {
+			return p.errorf("array %s declares %d items but has %d", formatPath(f.path), f.length, f.count)
+		}
+		p.repair("length", formatPath(f.path), "array declares %d items but has %d", f.length, f.count)
+	}
+	if f.count == 0 {
+		if p.template && f.kind == tableFrame {
+			p.placeholderRow(f)
+			return nil
+		}
+		if f.kind == objectFrame {
+			p.leaf(f.path, NewObject())
+		} else {
+			p.leaf(f.path, []interface{}{})
+		}
+		return nil
+	}
+	p.emit(Event{Path: appendPath(f.path, f.last), Closing: true})
+	return nil
+}
+
+// field handles a `key: value`, `key:` or `key[N]...:` line inside an
+// object.
+func (p *parser) field(f *frame, content string) error {
+	key, rest, err := p.key(content)
+	if err != nil {
+		return err
+	}
+	f.count++
+	f.last = key
+	path := appendPath(f.path, key)
+
+	if rest[0] == '[' {
+		return p.header(path, f.depth, rest)
+	}
+	value := strings.TrimSpace(rest[1:])
+	if value == "" {
+		p.pending = &pendingKey{path: path, depth: f.depth}
+		return nil
+	}
+	v, err := p.primitive(value)
+	if err != nil {
+		return err
+	}
+	p.leaf(path, v)
+	return nil
+}
+
+// item handles a `- ...` line inside a list array.
+func (p *parser) item(f *frame, content string) error {
+	if content != "-" && !strings.HasPrefix(content, "- ") {
+		return p.errorf("expected list item starting with \"- \"")
+	}
+	f.count++
+	if f.length >= 0 && f.count > f.length && !p.lenient {
+		return p.errorf("array %s declares %d items but has more", formatPath(f.path), f.length)
+	}
+	f.last = f.count - 1
+	path := appendPath(f.path, f.last)
+
+	body := strings.TrimPrefix(strings.TrimPrefix(content, "-"), " ")
+	switch {
+	case body == "":
+		p.leaf(path, NewObject())
+		return nil
+	case body[0] == '[':
+		return p.header(path, f.depth, body)
+	case unquotedIndex(body, ':') >= 0:
+		obj := &frame{kind: objectFrame, depth: f.depth + 1, path: path}
+		p.stack = append(p.stack, obj)
+		return p.field(obj, body)
+	}
+	v, err := p.primitive(body)
+	if err != nil {
+		return err
+	}
+	p.leaf(path, v)
+	return nil
+}
+
+// row handles one delimited row of a tabular array.
+func (p *parser) row(f *frame, content string) error {
+	f.count++
+	if f.length >= 0 && f.count > f.length && !p.lenient {
+		return p.errorf("array %s declares %d rows but has more", formatPath(f.path), f.length)
+	}
+	f.last = f.count - 1
+	path := appendPath(f.path, f.last)
+
+	if p.final && content[len(content)-1] == f.delim {
+		// A last row ending in a delimiter was cut off before its next value
+		return p.errorf("row ends with a delimiter")
+	}
+	cells := splitDelimited(content, f.delim)
+	if len(cells) != len(f.fields) {
+		// A short last row was cut off; earlier ones are padded
+		if !p.lenient || len(cells) < len(f.fields) && p.final {
+			return p.errorf("row has %d values but header declares %d fields", len(cells), len(f.fields))
+		}
+		if len(cells) < len(f.fields) {
+			p.repair("row", formatPath(path), "row has %d values but header declares %d fields; missing fields set to null", len(cells), len(f.fields))
+		} else {
+			p.repair("row", formatPath(path), "row has %d values but header declares %d fields; extra values dropped", len(cells), len(f.fields))
+		}
+	}
+	var obj *Object
+	if p.rows != nil {
+		obj = NewObject()
+	}
+	for i, name := range f.fields {
+		var v interface{}
+		if i < len(cells) {
+			var err error
+			if v, err = p.primitive(cells[i]); err != nil {
+				return err
+			}
+		}
+		if obj != nil {
+			obj.Set(name, v)
+		} else {
+			p.leaf(appendPath(path, name), v)
+		}
+	}
+	if obj != nil {
+		p.rows(path, obj)
+		return nil
+	}
+	p.emit(Event{Path: appendPath(path, f.fields[len(f.fields)-1]), Closing: true})
+	return nil
+}
+
+// header handles an array header found at depth. Child lines, if any,
+// are expected one level deeper.
+func (p *parser) header(path []interface{}, depth int, s string) error {
+	h, err := p.parseHeader(s)
+	if err != nil {
+		return err
+	}
+	switch {
+	case h.fields != nil:
+		if h.inline != "" {
+			return p.errorf("tabular array header cannot have inline values")
+		}
+		if h.length == 0 {
+			p.leaf(path, []interface{}{})
+			return nil
+		}
+		p.stack = append(p.stack, &frame{kind: tableFrame, depth: depth + 1, path: path,
+			length: h.length, delim: h.delim, fields: h.fields})
+	case h.inline != "":
+		cells := splitDelimited(h.inline, h.delim)
+		if h.length >= 0 && len(cells) != h.length {
+			if !p.lenient {
+				return p.errorf("array %s declares %d items but has %d", formatPath(path), h.length, len(cells))
+			}
+			p.repair("length", formatPath(path), "array declares %d items but has %d", h.length, len(cells))
+		}
+		for i, cell := range cells {
+			v, err := p.primitive(cell)
+			if err != nil {
+				return err
+			}
+			p.leaf(appendPath(path, i), v)
+		}
+		p.emit(Event{Path: appendPath(path, len(cells)-1), Closing: true})
+	case h.length == 0:
+		p.leaf(path, []interface{}{})
+	default:
+		p.stack = append(p.stack, &frame{kind: listFrame, depth: depth + 1, path: path, length: h.length})
+	}
+	return nil
+}
+
+// parseHeader parses `[N<delim>]{fields}: inline` starting at s[0] == '['.
+func (p *parser) parseHeader(s string) (header, error) {
+	h := header{delim: ','}
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return h, p.errorf("unterminated array length")
+	}
+	spec := strings.TrimPrefix(s[1:end], "#")
+	if n := len(spec); n > 0 && (spec[n-1] == '\t' || spec[n-1] == '|') {
+		h.delim = spec[n-1]
+		spec = spec[:n-1]
+	}
+	length, err := strconv.Atoi(spec)
+	switch {
+	case p.template && (err == nil && length >= 0 || lengthName.MatchString(spec)):
+		// Templates allow any number of items
+		length = -1
+	case err != nil || length < 0:
+		return h, p.errorf("invalid array length %q", s[1:end])
+	}
+	h.length = length
+
+	rest := s[end+1:]
+	if strings.HasPrefix(rest, "{") {
+		close := unquotedIndex(rest, '}')
+		if close < 0 {
+			return h, p.errorf("unterminated field list")
+		}
+		h.fields = []string{}
+		for _, name := range splitDelimited(rest[1:close], h.delim) {
+			if strings.HasPrefix(name, "\"") {
+				unq, n, err := parseQuoted(name)
+				if err != nil || n != len(name) {
+					return h, p.errorf("invalid field name %s", name)
+				}
+				name = unq
+			}
+			h.fields = append(h.fields, name)
+		}
+		rest = rest[close+1:]
+	}
+	if !strings.HasPrefix(rest, ":") {
+		return h, p.errorf("expected ':' after array header")
+	}
+	h.inline = strings.Trim(rest[1:], " ")
+	return h, nil
+}
+
+// key splits a field line into its key and the remainder, which starts
+// with ':' or '['.
+func (p *parser) key(content string) (string, string, error) {
+	if content[0] == '"' {
+		key, n, err := parseQuoted(content)
+		if err != nil {
+			return "", "", p.errorf("%v", err)
+		}
+		rest := content[n:]
+		if rest == "" || (rest[0] != ':' && rest[0] != '[') {
+			return "", "", p.errorf("missing ':' after key %q", key)
+		}
+		return key, rest, nil
+	}
+	i := strings.IndexAny(content, ":[")
+	if i < 0 {
+		return "", "", p.errorf("missing ':' after key %q", content)
+	}
+	key := strings.TrimSpace(content[:i])
+	if key == "" {
+		return "", "", p.errorf("missing key before ':'")
+	}
+	return key, content[i:], nil
+}
+
+// primitive decodes a single scalar token.
+func (p *parser) primitive(tok string) (interface{}, error) {
+	tok = strings.TrimSpace(tok)
+	if strings.HasPrefix(tok, "\"") {
+		s, n, err := parseQuoted(tok)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if n != len(tok) {
+			return nil, p.errorf("unexpected characters after string %s", tok[:n])
+		}
+		return s, nil
+	}
+	switch tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if numberPattern.MatchString(tok) {
+		return json.Number(tok), nil
+	}
+	return tok, nil
+}
+
+func (p *parser) leaf(path []interface{}, v interface{}) {
+	p.emit(Event{Path: path, Value: v})
+}
+
+// parseQuoted decodes the double-quoted string at the start of s and
+// returns it with the number of bytes consumed.
+func parseQuoted(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i >= len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			switch s[i] {
+			case '\\', '"':
+				b.WriteByte(s[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				return "", 0, fmt.Errorf("invalid escape sequence \\%c", s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// unquotedIndex returns the index of the first c in s that is not inside a
+// quoted string, or -1.
+func unquotedIndex(s string, c byte) int {
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitDelimited splits s on delim, ignoring delimiters inside quoted
+// strings. Cells are returned with surrounding whitespace removed.
+func splitDelimited(s string, delim byte) []string {
+	var cells []string
+	for {
+		i := unquotedIndex(s, delim)
+		if i < 0 {
+			return append(cells, strings.TrimSpace(s))
+		}
+		cells = append(cells, strings.TrimSpace(s[:i]))
+		s = s[i+1:]
+	}
+}
+
+// appendPath returns a new path with key appended, leaving path untouched.
+func appendPath(path []interface{}, key interface{}) []interface{} {
+	out := make([]interface{}, len(path)+1)
+	copy(out, path)
+	out[len(path)] = key
+	return out
+}
+
+// formatPath renders a path in jq syntax, e.g. .users[0].name.
+func formatPath(path []interface{}) string {
+	if len(path) == 0 {
+		return "."
+	}
+	var b strings.Builder
+	for _, k := range path {
+		switch k := k.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", k)
+		default:
+			fmt.Fprintf(&b, ".%v", k)
+		}
+	}
+	return b.String()
+}
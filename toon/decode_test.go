@@ -0,0 +1,195 @@
+package toon
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "simple object",
+			input: "name: John\nage: 30\nactive: true",
+			want:  `{"name":"John","age":30,"active":true}`,
+		},
+		{
+			name:  "empty document",
+			input: "",
+			want:  `{}`,
+		},
+		{
+			name:  "nested and empty objects",
+			input: "address:\n  city: SF\n  geo:\n    lat: 1.5\nextra:\nlast: null",
+			want:  `{"address":{"city":"SF","geo":{"lat":1.5}},"extra":{},"last":null}`,
+		},
+		{
+			name:  "tabular array keeps field order",
+			input: "users[2]{name,id}:\n  Alice,1\n  Bob,2",
+			want:  `{"users":[{"name":"Alice","id":1},{"name":"Bob","id":2}]}`,
+		},
+		{
+			name:  "inline primitive array",
+			input: "tags[3]: a,\"b,c\",3",
+			want:  `{"tags":["a","b,c",3]}`,
+		},
+		{
+			name:  "pipe and tab delimiters",
+			input: "a[2|]: x|y\nb[1\t]{p\tq}:\n  1\t2",
+			want:  `{"a":["x","y"],"b":[{"p":1,"q":2}]}`,
+		},
+		{
+			name:  "empty array",
+			input: "items[0]:",
+			want:  `{"items":[]}`,
+		},
+		{
+			name:  "list array with mixed items",
+			input: "items[4]:\n  - id: 1\n    name: x\n  - 5\n  - [2]: 1,2\n  -",
+			want:  `{"items":[{"id":1,"name":"x"},5,[1,2],{}]}`,
+		},
+		{
+			name:  "list item with tabular first field",
+			input: "groups[1]:\n  - rows[2]{a}:\n      1\n      2\n    label: g",
+			want:  `{"groups":[{"rows":[{"a":1},{"a":2}],"label":"g"}]}`,
+		},
+		{
+			name:  "root array",
+			input: "[2]{id}:\n  1\n  2",
+			want:  `[{"id":1},{"id":2}]`,
+		},
+		{
+			name:  "root primitive",
+			input: "\"hello world\"",
+			want:  `"hello world"`,
+		},
+		{
+			name:  "quoted keys and escapes",
+			input: "\"full name\": \"a\\\"b\\n\"\nzip: \"01234\"\ncode: 007",
+			want:  `{"full name":"a\"b\n","zip":"01234","code":"007"}`,
+		},
+		{
+			name:    "row count mismatch",
+			input:   "users[3]{name}:\n  Alice\n  Bob",
+			wantErr: true,
+		},
+		{
+			name:    "too many rows",
+			input:   "users[1]{name}:\n  Alice\n  Bob",
+			wantErr: true,
+		},
+		{
+			name:    "row width mismatch",
+			input:   "users[1]{name,age}:\n  Alice",
+			wantErr: true,
+		},
+		{
+			name:    "odd indentation",
+			input:   "a:\n   b: 1",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated string",
+			input:   "a: \"oops",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Decode([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var syntaxErr *SyntaxError
+				if !errors.As(err, &syntaxErr) {
+					t.Errorf("Decode() error = %T, want *SyntaxError", err)
+				}
+				return
+			}
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Decode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoderEvents(t *testing.T) {
+	// Expected output matches `jq -c --stream .` on the equivalent JSON.
+	input := "company: Acme\nstaff[2]{id,name}:\n  1,Alice\n  2,Bob\ntags[1]: x\nmeta:\n"
+	want := []string{
+		`[["company"],"Acme"]`,
+		`[["staff",0,"id"],1]`,
+		`[["staff",0,"name"],"Alice"]`,
+		`[["staff",0,"name"]]`,
+		`[["staff",1,"id"],2]`,
+		`[["staff",1,"name"],"Bob"]`,
+		`[["staff",1,"name"]]`,
+		`[["staff",1]]`,
+		`[["tags",0],"x"]`,
+		`[["tags",0]]`,
+		`[["meta"],{}]`,
+		`[["meta"]]`,
+	}
+
+	dec := NewDecoder(strings.NewReader(input))
+	var got []string
+	for {
+		ev, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		b, err := json.Marshal(ev)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		got = append(got, string(b))
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	events := []Event{
+		{Path: []interface{}{"a", 0}, Value: json.Number("1")},
+		{Path: []interface{}{"a", 1}, Value: json.Number("2")},
+		{Path: []interface{}{"a", 1}, Closing: true},
+		{Path: []interface{}{"b"}, Value: "x"},
+		{Path: []interface{}{"b"}, Closing: true},
+		{Path: []interface{}{}, Value: true},
+	}
+	want := []string{`{"a":[1,2],"b":"x"}`, `true`}
+
+	var b Builder
+	var got []string
+	for _, ev := range events {
+		v, done, err := b.Push(ev)
+		if err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+		if done {
+			out, _ := json.Marshal(v)
+			got = append(got, string(out))
+		}
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+}
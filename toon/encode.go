@@ -0,0 +1,502 @@
+package toon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// EncodeOptions controls the layout chosen by Encode. The zero value
+// gives the default TOON style: comma delimiters and plain [N] lengths.
+type EncodeOptions struct {
+	// Delimiter separates inline array values and tabular cells: ',' (the
+	// default), '\t' or '|'. Non-comma delimiters are declared in each
+	// array header, e.g. [3|].
+	Delimiter byte
+	// LengthMarker writes array lengths as [#N].
+	LengthMarker bool
+	// MaxItems, when positive, keeps only the first MaxItems elements of
+	// each array. The header counts the elements kept, and a comment line
+	// such as `# 4,812 more rows omitted` takes the place of the rest.
+	MaxItems int
+	// MaxString, when positive, cuts strings after MaxString characters
+	// and notes how many were dropped, e.g. `Lorem ipsum… (+1,234 chars)`.
+	MaxString int
+	// Arrays overrides the layout and delimiter of arrays by path, as
+	// given by WalkArrays.
+	Arrays map[string]ArrayStyle
+}
+
+// Layout is a way of writing an array.
+type Layout int
+
+const (
+	// Auto writes arrays of primitives inline, arrays of objects with the
+	// same primitive fields as tables, and anything else as a list.
+	Auto Layout = iota
+	// Tabular writes a header with the field names and one row per object.
+	Tabular
+	// Inline writes the values on the header line.
+	Inline
+	// List writes one `- ` item per element.
+	List
+)
+
+var layoutNames = [...]string{"auto", "tabular", "inline", "list"}
+
+func (l Layout) String() string {
+	if l < 0 || int(l) >= len(layoutNames) {
+		return "Layout(" + strconv.Itoa(int(l)) + ")"
+	}
+	return layoutNames[l]
+}
+
+// ArrayStyle selects how the arrays at one path are written. A layout
+// that does not fit an array, such as Tabular for an array of numbers,
+// falls back to Auto.
+type ArrayStyle struct {
+	Layout Layout
+	// Delimiter is ',', '\t' or '|', or 0 for EncodeOptions.Delimiter.
+	Delimiter byte
+}
+
+// bareKeyPattern matches object keys and field names that need no quotes.
+var bareKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// numericLike matches strings that would read back as numbers, including
+// forms with leading zeros that a lenient reader might accept.
+var numericLike = regexp.MustCompile(`^-?\d+(?:\.\d+)?(?:[eE][+-]?\d+)?$`)
+
+// Encode renders v as a TOON document without a trailing newline. v uses
+// the representation produced by Decode and DecodeJSON: *Object,
+// []interface{}, string, json.Number, bool and nil. Arrays of objects
+// with identical keys and primitive values are written as tabular arrays,
+// arrays of primitives inline, and everything else as lists.
+func Encode(v interface{}, opts *EncodeOptions) (string, error) {
+	e := &encoder{delim: ','}
+	if opts != nil {
+		if opts.Delimiter != 0 {
+			e.delim = opts.Delimiter
+		}
+		e.marker = opts.LengthMarker
+		e.maxItems = opts.MaxItems
+		e.maxString = opts.MaxString
+		e.arrays = opts.Arrays
+	}
+	if !validDelimiter(e.delim) {
+		return "", fmt.Errorf("unsupported delimiter %q", e.delim)
+	}
+	for path, style := range e.arrays {
+		if style.Delimiter != 0 && !validDelimiter(style.Delimiter) {
+			return "", fmt.Errorf("%s: unsupported delimiter %q", path, style.Delimiter)
+		}
+	}
+
+	var err error
+	e.path = "."
+	switch v := v.(type) {
+	case *Object:
+		err = e.fields(v, 0)
+	case []interface{}:
+		err = e.array(0, 0, "", v)
+	default:
+		var s string
+		s, err = e.primitive(v)
+		e.lines = append(e.lines, s)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(e.lines, "\n"), nil
+}
+
+type encoder struct {
+	delim     byte
+	marker    bool
+	maxItems  int
+	maxString int
+	arrays    map[string]ArrayStyle
+	path      string // path of the value being written, as in WalkArrays
+	lines     []string
+}
+
+func validDelimiter(d byte) bool {
+	return d == ',' || d == '\t' || d == '|'
+}
+
+// WalkArrays calls fn for every array in v, parents before their
+// elements, with its path: the jq path of the array with element indices
+// left out, such as ".users", ".orders[].items" or "." for the root. All
+// arrays at one path share the style given for it in EncodeOptions.Arrays.
+func WalkArrays(v interface{}, fn func(path string, arr []interface{})) {
+	walkArrays(".", v, fn)
+}
+
+func walkArrays(path string, v interface{}, fn func(string, []interface{})) {
+	switch v := v.(type) {
+	case *Object:
+		for _, k := range v.Keys() {
+			val, _ := v.Get(k)
+			walkArrays(FieldPath(path, k), val, fn)
+		}
+	case []interface{}:
+		fn(path, v)
+		for _, item := range v {
+			walkArrays(itemPath(path), item, fn)
+		}
+	}
+}
+
+func (e *encoder) line(depth int, s string) {
+	e.lines = append(e.lines, strings.Repeat(" ", depth*indentSize)+s)
+}
+
+// fields writes the fields of obj, one per line at depth.
+func (e *encoder) fields(obj *Object, depth int) error {
+	for _, k := range obj.Keys() {
+		v, _ := obj.Get(k)
+		if err := e.field(depth, depth, "", k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field writes `key: value`, or a nested object or array under key. The
+// line is indented to lineDepth and starts with lead ("- " for the first
+// field of a list item); nested content goes below depth.
+func (e *encoder) field(lineDepth, depth int, lead, key string, v interface{}) error {
+	parent := e.path
+	e.path = FieldPath(parent, key)
+	defer func() { e.path = parent }()
+
+	k := encodeKey(key)
+	switch v := v.(type) {
+	case *Object:
+		e.line(lineDepth, lead+k+":")
+		return e.fields(v, depth+1)
+	case []interface{}:
+		return e.array(lineDepth, depth, lead+k, v)
+	}
+	s, err := e.primitive(v)
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	e.line(lineDepth, lead+k+": "+s)
+	return nil
+}
+
+// array writes an array header starting with prefix and its content.
+func (e *encoder) array(lineDepth, depth int, prefix string, arr []interface{}) error {
+	if len(arr) == 0 {
+		e.line(lineDepth, prefix+e.header(0)+":")
+		return nil
+	}
+	omitted := 0
+	if e.maxItems > 0 && len(arr) > e.maxItems {
+		arr, omitted = arr[:e.maxItems], len(arr)-e.maxItems
+	}
+	style := e.arrays[e.path]
+	if style.Delimiter != 0 {
+		delim := e.delim
+		e.delim = style.Delimiter
+		defer func() { e.delim = delim }()
+	}
+
+	fields := TabularFields(arr)
+	layout := style.Layout
+	if layout == Tabular && fields == nil || layout == Inline && !Primitives(arr) || layout < Auto || layout > List {
+		layout = Auto
+	}
+	if layout == Auto {
+		switch {
+		case Primitives(arr):
+			layout = Inline
+		case fields != nil:
+			layout = Tabular
+		default:
+			layout = List
+		}
+	}
+
+	if layout == Inline {
+		cells, err := e.inline(arr)
+		if err != nil {
+			return err
+		}
+		e.line(lineDepth, prefix+e.header(len(arr))+": "+cells)
+		e.omitted(depth+1, omitted, "item")
+		return nil
+	}
+
+	if layout == Tabular {
+		names := make([]string, len(fields))
+		for i, f := range fields {
+			names[i] = encodeKey(f)
+		}
+		e.line(lineDepth, prefix+e.header(len(arr))+"{"+strings.Join(names, string(e.delim))+"}:")
+		for _, item := range arr {
+			obj := item.(*Object)
+			cells := make([]string, len(fields))
+			for i, f := range fields {
+				val, _ := obj.Get(f)
+				s, err := e.primitive(val)
+				if err != nil {
+					return err
+				}
+				cells[i] = s
+			}
+			e.line(depth+1, strings.Join(cells, string(e.delim)))
+		}
+		e.omitted(depth+1, omitted, "row")
+		return nil
+	}
+
+	e.line(lineDepth, prefix+e.header(len(arr))+":")
+	parent := e.path
+	e.path = itemPath(parent)
+	defer func() { e.path = parent }()
+	for _, item := range arr {
+		if err := e.item(depth+1, item); err != nil {
+			return err
+		}
+	}
+	e.omitted(depth+1, omitted, "item")
+	return nil
+}
+
+// omittedMarker matches the comment line written by omitted. Decoders skip
+// it, and needsQuotes quotes strings that could be mistaken for it.
+var omittedMarker = regexp.MustCompile(`^# [\d,]+ more (?:rows?|items?) omitted$`)
+
+// omitted writes the comment line that stands in for n trimmed elements.
+func (e *encoder) omitted(depth, n int, what string) {
+	if n > 1 {
+		what += "s"
+	}
+	if n > 0 {
+		e.line(depth, "# "+Thousands(n)+" more "+what+" omitted")
+	}
+}
+
+// item writes one element of a list array at depth.
+func (e *encoder) item(depth int, v interface{}) error {
+	switch v := v.(type) {
+	case *Object:
+		if v.Len() == 0 {
+			e.line(depth, "-")
+			return nil
+		}
+		// The first field shares the hyphen line; the rest follow below it
+		keys := v.Keys()
+		first, _ := v.Get(keys[0])
+		if err := e.field(depth, depth+1, "- ", keys[0], first); err != nil {
+			return err
+		}
+		for _, k := range keys[1:] {
+			val, _ := v.Get(k)
+			if err := e.field(depth+1, depth+1, "", k, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		return e.array(depth, depth, "- ", v)
+	}
+	s, err := e.primitive(v)
+	if err != nil {
+		return err
+	}
+	e.line(depth, "- "+s)
+	return nil
+}
+
+// Primitives reports whether no element of arr is an object or array, so
+// that arr can be written as an inline array.
+func Primitives(arr []interface{}) bool {
+	for _, item := range arr {
+		switch item.(type) {
+		case *Object, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+// inline joins the primitive elements of arr with the delimiter.
+func (e *encoder) inline(arr []interface{}) (string, error) {
+	cells := make([]string, len(arr))
+	for i, item := range arr {
+		s, err := e.primitive(item)
+		if err != nil {
+			return "", err
+		}
+		cells[i] = s
+	}
+	return strings.Join(cells, string(e.delim)), nil
+}
+
+// header renders [N], with the length marker and delimiter when set.
+func (e *encoder) header(n int) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	if e.marker {
+		b.WriteByte('#')
+	}
+	b.WriteString(strconv.Itoa(n))
+	if e.delim != ',' {
+		b.WriteByte(e.delim)
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// primitive renders a scalar, quoting strings that would otherwise read
+// back as something else.
+func (e *encoder) primitive(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return FormatNumber(v), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "null", nil
+		}
+		return FormatNumber(json.Number(strconv.FormatFloat(v, 'f', -1, 64))), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case string:
+		if e.maxString > 0 && utf8.RuneCountInString(v) > e.maxString {
+			v = truncate(v, e.maxString)
+		}
+		if needsQuotes(v, e.delim) {
+			return quote(v), nil
+		}
+		return v, nil
+	}
+	return "", fmt.Errorf("unsupported value of type %T", v)
+}
+
+// TabularFields returns the field names of arr if it can be written as a
+// tabular array: a non-empty array of non-empty objects that all have the
+// same keys and only primitive values. Fields are in the order of the
+// first object. It returns nil otherwise.
+func TabularFields(arr []interface{}) []string {
+	if len(arr) == 0 {
+		return nil
+	}
+	first, ok := arr[0].(*Object)
+	if !ok || first.Len() == 0 {
+		return nil
+	}
+	fields := first.Keys()
+	for _, item := range arr {
+		obj, ok := item.(*Object)
+		if !ok || obj.Len() != len(fields) {
+			return nil
+		}
+		for _, f := range fields {
+			v, ok := obj.Get(f)
+			if !ok {
+				return nil
+			}
+			switch v.(type) {
+			case *Object, []interface{}:
+				return nil
+			}
+		}
+	}
+	return fields
+}
+
+// FormatNumber writes a JSON number in canonical TOON form: no exponent,
+// no trailing fractional zeros, and no negative zero.
+func FormatNumber(n json.Number) string {
+	s := string(n)
+	if strings.ContainsAny(s, ".eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err == nil && !math.IsInf(f, 0) {
+			s = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	}
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// Thousands formats n with comma digit grouping, e.g. 4,812.
+func Thousands(n int) string {
+	s := strconv.Itoa(n)
+	start := 0
+	if n < 0 {
+		start = 1
+	}
+	for i := len(s) - 3; i > start; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// truncate keeps the first n characters of s and notes how many follow.
+func truncate(s string, n int) string {
+	cut := 0
+	for i := 0; i < n; i++ {
+		_, size := utf8.DecodeRuneInString(s[cut:])
+		cut += size
+	}
+	return s[:cut] + "… (+" + Thousands(utf8.RuneCountInString(s[cut:])) + " chars)"
+}
+
+// needsQuotes reports whether s must be quoted to read back as the same
+// string in a context where delim separates values.
+func needsQuotes(s string, delim byte) bool {
+	switch {
+	case s == "", s != strings.TrimSpace(s), strings.HasPrefix(s, "#"):
+		return true
+	case s == "true", s == "false", s == "null":
+		return true
+	case numericLike.MatchString(s), strings.HasPrefix(s, "-"):
+		return true
+	case strings.ContainsAny(s, ":\"\\[]{}\n\r\t"), strings.IndexByte(s, delim) >= 0:
+		return true
+	}
+	return false
+}
+
+func encodeKey(k string) string {
+	if bareKeyPattern.MatchString(k) {
+		return k
+	}
+	return quote(k)
+}
+
+// quote writes s as a double-quoted string using the escapes TOON allows.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,222 @@
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  *EncodeOptions
+		want  string
+	}{
+		{
+			name:  "simple object",
+			input: `{"name":"John","age":30,"active":true,"none":null}`,
+			want:  "name: John\nage: 30\nactive: true\nnone: null",
+		},
+		{
+			name:  "nested and empty objects",
+			input: `{"address":{"city":"SF","geo":{"lat":1.5}},"extra":{}}`,
+			want:  "address:\n  city: SF\n  geo:\n    lat: 1.5\nextra:",
+		},
+		{
+			name:  "tabular array keeps field order",
+			input: `{"users":[{"name":"Alice","id":1},{"id":2,"name":"Bob"}]}`,
+			want:  "users[2]{name,id}:\n  Alice,1\n  Bob,2",
+		},
+		{
+			name:  "inline and empty arrays",
+			input: `{"tags":["a","b,c",3],"none":[]}`,
+			want:  "tags[3]: a,\"b,c\",3\nnone[0]:",
+		},
+		{
+			name:  "list of mixed items",
+			input: `{"items":[1,{"a":1,"b":[{"x":1},{"x":2}]},[1,2],{},{"t":[{"x":1}],"u":2}]}`,
+			want: "items[5]:\n  - 1\n  - a: 1\n    b[2]{x}:\n      1\n      2\n  - [2]: 1,2\n  -\n" +
+				"  - t[1]{x}:\n      1\n    u: 2",
+		},
+		{
+			name:  "root array and primitive",
+			input: `[{"a":1},{"a":2}]`,
+			want:  "[2]{a}:\n  1\n  2",
+		},
+		{
+			name:  "strings that need quotes",
+			input: `{"a":"","b":" x","c":"true","d":"42","e":"007","f":"-x","g":"a:b","h":"line\nbreak","i":"ok text","j k":1}`,
+			want:  "a: \"\"\nb: \" x\"\nc: \"true\"\nd: \"42\"\ne: \"007\"\nf: \"-x\"\ng: \"a:b\"\nh: \"line\\nbreak\"\ni: ok text\n\"j k\": 1",
+		},
+		{
+			name:  "canonical numbers",
+			input: `[1.50,1e6,-0,2.5E-3,12345678901234567890]`,
+			want:  "[5]: 1.5,1000000,0,0.0025,12345678901234567890",
+		},
+		{
+			name:  "pipe delimiter and length marker",
+			input: `{"rows":[{"a":"x,y","b":"p|q"}],"tags":["a","b"]}`,
+			opts:  &EncodeOptions{Delimiter: '|', LengthMarker: true},
+			want:  "rows[#1|]{a|b}:\n  x,y|\"p|q\"\ntags[#2|]: a|b",
+		},
+		{
+			name:  "layout and delimiter by path",
+			input: `{"users":[{"id":1,"tags":["a","b"]},{"id":2,"tags":["c"]}],"rows":[{"a":"x,y"}],"nums":[1,2]}`,
+			opts: &EncodeOptions{Arrays: map[string]ArrayStyle{
+				".users[].tags": {Layout: List},
+				".rows":         {Layout: Tabular, Delimiter: '\t'},
+				".nums":         {Layout: Tabular, Delimiter: '|'},
+			}},
+			want: "users[2]:\n  - id: 1\n    tags[2]:\n      - a\n      - b\n  - id: 2\n    tags[1]:\n      - c\n" +
+				"rows[1\t]{a}:\n  x,y\nnums[2|]: 1|2",
+		},
+		{
+			name:  "tabular array as a list",
+			input: `[{"a":1,"b":"x"},{"a":2,"b":"y"}]`,
+			opts:  &EncodeOptions{Arrays: map[string]ArrayStyle{".": {Layout: List}}},
+			want:  "[2]:\n  - a: 1\n    b: x\n  - a: 2\n    b: y",
+		},
+		{
+			name:  "empty document",
+			input: `{}`,
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := DecodeJSON([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Encode(v, tt.opts)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+
+			// The output must decode to the same value, up to key order
+			back, err := Decode([]byte(got))
+			if err != nil {
+				t.Fatalf("Decode(Encode()) error = %v", err)
+			}
+			if a, b := unordered(t, back), unordered(t, v); !reflect.DeepEqual(a, b) {
+				t.Errorf("round trip = %v, want %v", a, b)
+			}
+		})
+	}
+}
+
+func TestEncodeInvalidDelimiter(t *testing.T) {
+	if _, err := Encode([]interface{}{}, &EncodeOptions{Delimiter: ';'}); err == nil {
+		t.Error("Encode() with ';' delimiter succeeded, want error")
+	}
+	if _, err := Encode([]interface{}{}, &EncodeOptions{Arrays: map[string]ArrayStyle{".": {Delimiter: ';'}}}); err == nil {
+		t.Error("Encode() with ';' array delimiter succeeded, want error")
+	}
+}
+
+func TestWalkArrays(t *testing.T) {
+	v, err := DecodeJSON([]byte(`{"a":[[1],{"b":[2]}],"x y":{"c":[],"e f":[3]},"d":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	WalkArrays(v, func(path string, arr []interface{}) {
+		got = append(got, path)
+	})
+	want := []string{".a", ".a[]", ".a[].b", `.["x y"].c`, `.["x y"]["e f"]`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WalkArrays() paths = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeTruncated(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  *EncodeOptions
+		want  string
+		// decoded is the output read back with Decode, as JSON
+		decoded string
+	}{
+		{
+			name:  "rows, list items and inline values",
+			input: `{"users":[{"id":1},{"id":2},{"id":3}],"items":[{"a":[1]},2,3],"tags":["a","b","c"],"one":[1]}`,
+			opts:  &EncodeOptions{MaxItems: 1},
+			want: "users[1]{id}:\n  1\n  # 2 more rows omitted\nitems[1]:\n  - a[1]: 1\n  # 2 more items omitted\n" +
+				"tags[1]: a\n  # 2 more items omitted\none[1]: 1",
+			decoded: `{"users":[{"id":1}],"items":[{"a":[1]}],"tags":["a"],"one":[1]}`,
+		},
+		{
+			name:    "root array",
+			input:   `[{"a":1},{"a":2},{"a":3}]`,
+			opts:    &EncodeOptions{MaxItems: 2},
+			want:    "[2]{a}:\n  1\n  2\n  # 1 more row omitted",
+			decoded: `[{"a":1},{"a":2}]`,
+		},
+		{
+			name:    "long strings",
+			input:   `{"short":"abc","long":"héllo wörld","key":"a:bcdef"}`,
+			opts:    &EncodeOptions{MaxString: 5},
+			want:    "short: abc\nlong: héllo… (+6 chars)\nkey: \"a:bcd… (+2 chars)\"",
+			decoded: `{"short":"abc","long":"héllo… (+6 chars)","key":"a:bcd… (+2 chars)"}`,
+		},
+		{
+			name:    "strings that look like comments are quoted",
+			input:   `{"notes":[{"t":"# 2 more items omitted"},{"t":"b"}],"tags":["#x","y"]}`,
+			opts:    &EncodeOptions{MaxItems: 1},
+			want:    "notes[1]{t}:\n  \"# 2 more items omitted\"\n  # 1 more row omitted\ntags[1]: \"#x\"\n  # 1 more item omitted",
+			decoded: `{"notes":[{"t":"# 2 more items omitted"}],"tags":["#x"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := DecodeJSON([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Encode(v, tt.opts)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+			back, err := Decode([]byte(got))
+			if err != nil {
+				t.Fatalf("Decode() of the output error = %v", err)
+			}
+			if data, _ := json.Marshal(back); string(data) != tt.decoded {
+				t.Errorf("Decode() of the output = %s, want %s", data, tt.decoded)
+			}
+		})
+	}
+}
+
+func TestThousands(t *testing.T) {
+	tests := map[int]string{0: "0", 999: "999", 1000: "1,000", 4812: "4,812", 1234567: "1,234,567", -1234: "-1,234", -123: "-123"}
+	for n, want := range tests {
+		if got := Thousands(n); got != want {
+			t.Errorf("Thousands(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+// unordered converts v to plain maps and float64 numbers for comparison.
+func unordered(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
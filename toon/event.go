@@ -0,0 +1,118 @@
+package toon
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Event is a single path event in the format produced by jq's --stream
+// option. A leaf event carries the path to a scalar (or empty container)
+// and its value. A closing event carries only a path: the path of the last
+// child of a container that has just ended.
+type Event struct {
+	Path    []interface{}
+	Value   interface{}
+	Closing bool
+}
+
+// MarshalJSON encodes the event as [path, value] or, for closing events,
+// as [path].
+func (e Event) MarshalJSON() ([]byte, error) {
+	path := e.Path
+	if path == nil {
+		path = []interface{}{}
+	}
+	p, err := marshal(path)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	buf.Write(p)
+	if !e.Closing {
+		v, err := marshal(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(v)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// Builder reassembles complete values from a sequence of events, the same
+// way jq's fromstream does.
+type Builder struct {
+	root interface{}
+}
+
+// Push adds an event to the value under construction. When the event
+// completes a top-level value, Push returns it with done set to true.
+func (b *Builder) Push(ev Event) (value interface{}, done bool, err error) {
+	if !ev.Closing {
+		if len(ev.Path) == 0 {
+			return ev.Value, true, nil
+		}
+		b.root, err = setPath(b.root, ev.Path, ev.Value)
+		return nil, false, err
+	}
+	if len(ev.Path) == 1 {
+		value, b.root = b.root, nil
+		return value, true, nil
+	}
+	return nil, false, nil
+}
+
+// setPath stores value at path inside container, creating intermediate
+// arrays and objects as needed, and returns the updated container.
+func setPath(container interface{}, path []interface{}, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch key := path[0].(type) {
+	case int:
+		var arr []interface{}
+		if container != nil {
+			a, ok := container.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot index %T with number", container)
+			}
+			arr = a
+		}
+		if key < 0 || key > len(arr) {
+			return nil, fmt.Errorf("array index %d out of order", key)
+		}
+		var child interface{}
+		if key < len(arr) {
+			child = arr[key]
+		}
+		v, err := setPath(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		if key == len(arr) {
+			return append(arr, v), nil
+		}
+		arr[key] = v
+		return arr, nil
+	case string:
+		obj := NewObject()
+		if container != nil {
+			o, ok := container.(*Object)
+			if !ok {
+				return nil, fmt.Errorf("cannot index %T with %q", container, key)
+			}
+			obj = o
+		}
+		child, _ := obj.Get(key)
+		v, err := setPath(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(key, v)
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("invalid path component %v", path[0])
+	}
+}
@@ -0,0 +1,38 @@
+package toon
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "key order is kept", input: `{"z":1,"a":{"y":2,"b":3}}`, want: `{"z":1,"a":{"y":2,"b":3}}`},
+		{name: "numbers keep their text", input: `[1.50, 12345678901234567890]`, want: `[1.50,12345678901234567890]`},
+		{name: "empty containers", input: `{"a":[],"b":{}}`, want: `{"a":[],"b":{}}`},
+		{name: "scalar", input: `"x"`, want: `"x"`},
+		{name: "trailing data", input: `{} {}`, wantErr: true},
+		{name: "truncated", input: `{"a":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := DecodeJSON([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, _ := json.Marshal(v)
+			if string(got) != tt.want {
+				t.Errorf("DecodeJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Package toon implements a native Go decoder for TOON (Token-Oriented
+// Object Notation) documents.
+package toon
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Object is a JSON object that remembers the order in which its keys were
+// set. TOON tabular headers depend on field order, so decoded objects keep
+// it instead of using a plain map.
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewObject returns an empty Object.
+func NewObject() *Object {
+	return &Object{values: make(map[string]interface{})}
+}
+
+// Set stores value under key. New keys are appended; existing keys keep
+// their original position.
+func (o *Object) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Get returns the value stored under key.
+func (o *Object) Get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Keys returns the keys in insertion order.
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+// Len returns the number of keys.
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// MarshalJSON encodes the object with its keys in insertion order.
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshal encodes v as compact JSON without escaping HTML characters.
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -0,0 +1,57 @@
+package toon
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pathKeyPattern matches keys that can follow a dot in a path.
+var pathKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FieldPath returns the jq path of key in the object at path, such as
+// ".data.users" or `.["line items"]`. Paths start from ".", the root.
+func FieldPath(path, key string) string {
+	if pathKeyPattern.MatchString(key) {
+		return strings.TrimSuffix(path, ".") + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+func itemPath(path string) string {
+	if path == "." {
+		return ".[]"
+	}
+	return path + "[]"
+}
+
+// LastKey returns the last key in a path written by FieldPath, such as
+// "items" for .orders[].items, or "" for the root.
+func LastKey(path string) string {
+	key := ""
+	for rest := path; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, "[]"):
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "[\""):
+			quoted, err := strconv.QuotedPrefix(rest[1:])
+			if err != nil {
+				return key
+			}
+			key, _ = strconv.Unquote(quoted)
+			rest = strings.TrimPrefix(rest[1+len(quoted):], "]")
+		case rest[0] == '.':
+			end := 1
+			for end < len(rest) && rest[end] != '.' && rest[end] != '[' {
+				end++
+			}
+			if end > 1 {
+				key = rest[1:end]
+			}
+			rest = rest[end:]
+		default:
+			return key
+		}
+	}
+	return key
+}
@@ -0,0 +1,41 @@
+package toon
+
+import "testing"
+
+func TestFieldPath(t *testing.T) {
+	tests := []struct {
+		path string
+		key  string
+		want string
+	}{
+		{".", "users", ".users"},
+		{".data", "users", ".data.users"},
+		{".", "a b", `.["a b"]`},
+		{".x", "1st", `.x["1st"]`},
+		{".orders[]", "items", ".orders[].items"},
+	}
+	for _, tt := range tests {
+		if got := FieldPath(tt.path, tt.key); got != tt.want {
+			t.Errorf("FieldPath(%q, %q) = %s, want %s", tt.path, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLastKey(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{".", ""},
+		{".[]", ""},
+		{".users", "users"},
+		{".orders[].items", "items"},
+		{`.["line items"]`, "line items"},
+		{`.data["a.b[]"][]`, "a.b[]"},
+	}
+	for _, tt := range tests {
+		if got := LastKey(tt.path); got != tt.want {
+			t.Errorf("LastKey(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
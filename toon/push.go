@@ -0,0 +1,77 @@
+package toon
+
+import "bytes"
+
+// PushDecoder decodes TOON that is pushed to it in pieces of any size,
+// such as the output of a language model arriving token by token. Each
+// value is reported as soon as it is complete and no later input can
+// change it:
+//
+//   - a primitive field or list item once its line has ended
+//   - a tabular row, as one object, once its line has ended
+//   - an empty object or array once the next line shows it has no
+//     children, or at the end of the input
+//
+// Values are reported with their path from the root, in document order.
+// A PushDecoder never buffers more than the current line.
+type PushDecoder struct {
+	p    *parser
+	line []byte // the incomplete line received so far
+	err  error
+}
+
+// NewPushDecoder returns a PushDecoder that calls fn with each complete
+// value. A document that is a single primitive is reported with an empty
+// path.
+func NewPushDecoder(fn func(path []interface{}, value interface{})) *PushDecoder {
+	p := &parser{
+		emit: func(ev Event) {
+			if !ev.Closing {
+				fn(ev.Path, ev.Value)
+			}
+		},
+		rows: func(path []interface{}, row *Object) { fn(path, row) },
+	}
+	return &PushDecoder{p: p}
+}
+
+// Write decodes the complete lines in b and keeps the rest for the next
+// call. It returns the first syntax error found in the input; once that
+// has happened, every later call returns it as well.
+func (d *PushDecoder) Write(b []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	d.line = append(d.line, b...)
+	start := 0
+	for {
+		i := bytes.IndexByte(d.line[start:], '\n')
+		if i < 0 {
+			break
+		}
+		if d.err = d.p.feed(string(d.line[start : start+i+1])); d.err != nil {
+			return 0, d.err
+		}
+		start += i + 1
+	}
+	d.line = append(d.line[:0], d.line[start:]...)
+	return len(b), nil
+}
+
+// Close decodes the last line, which may lack a line terminator, and
+// closes the structures still open, which reports empty containers whose
+// children never came. It returns an error if the document is incomplete,
+// such as an array with fewer items than it declares.
+func (d *PushDecoder) Close() error {
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.line) > 0 {
+		if d.err = d.p.feed(string(d.line)); d.err != nil {
+			return d.err
+		}
+		d.line = nil
+	}
+	d.err = d.p.end()
+	return d.err
+}
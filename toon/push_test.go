@@ -0,0 +1,77 @@
+package toon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPushDecoder(t *testing.T) {
+	input := "query: cats\nresults[2]{id,title}:\n  1,A\n  2,\"B, c\"\nmeta:\ntags[2]: x,y\nnote: done"
+	want := []string{
+		`after 12 bytes: [["query"],"cats"]`,
+		`after 40 bytes: [["results",0],{"id":1,"title":"A"}]`,
+		`after 51 bytes: [["results",1],{"id":2,"title":"B, c"}]`,
+		`after 70 bytes: [["meta"],{}]`,
+		`after 70 bytes: [["tags",0],"x"]`,
+		`after 70 bytes: [["tags",1],"y"]`,
+		`at the end: [["note"],"done"]`,
+	}
+
+	var got []string
+	at := ""
+	dec := NewPushDecoder(func(path []interface{}, v interface{}) {
+		b, err := json.Marshal(Event{Path: path, Value: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, at+": "+string(b))
+	})
+	// Push one byte at a time, as a model streams tokens
+	for i := 0; i < len(input); i++ {
+		at = fmt.Sprintf("after %d bytes", i+1)
+		if _, err := dec.Write([]byte{input[i]}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	at = "at the end"
+	if err := dec.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("values =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPushDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		values  int
+		wantErr string // "write", "close" or empty
+	}{
+		{name: "bad row", input: "rows[2]{a,b}:\n  1,2\n  3\n", values: 1, wantErr: "write"},
+		{name: "missing rows", input: "rows[3]{a}:\n  1\n  2", values: 2, wantErr: "close"},
+		{name: "root primitive", input: "42", values: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := 0
+			dec := NewPushDecoder(func([]interface{}, interface{}) { values++ })
+			_, writeErr := dec.Write([]byte(tt.input))
+			closeErr := dec.Close()
+			if (writeErr != nil) != (tt.wantErr == "write") {
+				t.Errorf("Write() error = %v", writeErr)
+			}
+			if (closeErr != nil) != (tt.wantErr != "") {
+				t.Errorf("Close() error = %v", closeErr)
+			}
+			if values != tt.values {
+				t.Errorf("values = %d, want %d", values, tt.values)
+			}
+		})
+	}
+}
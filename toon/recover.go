@@ -0,0 +1,174 @@
+package toon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Repair describes one change the lenient decoder made to read malformed
+// input. Kind is one of:
+//
+//   - length: an array has more or fewer items than its [N] declares
+//   - row: a tabular row with too few values was padded with null, or
+//     one with too many was cut to the declared fields
+//   - indentation: a line was not indented by two spaces per level
+//   - skipped: a line that could not be read, or a marker of omitted
+//     elements written by the encoder, was ignored
+//   - truncated: the last line could not be read and was dropped, as
+//     happens when output is cut off
+type Repair struct {
+	Line int
+	Kind string
+	Path string // jq path of the array or row concerned, if any
+	Msg  string
+}
+
+func (r Repair) String() string {
+	if r.Path != "" {
+		return fmt.Sprintf("line %d: %s: %s", r.Line, r.Path, r.Msg)
+	}
+	return fmt.Sprintf("line %d: %s", r.Line, r.Msg)
+}
+
+// NewLenientDecoder returns a Decoder that reads as much of malformed TOON
+// from r as it can instead of stopping at the first error, as for output
+// of a language model that was cut off or miscounted its rows. Every
+// change it makes is recorded and returned by Repairs. Structures still
+// open at the end of the input are closed with the items read so far.
+func NewLenientDecoder(r io.Reader) *Decoder {
+	d := NewDecoder(r)
+	d.p.lenient = true
+	return d
+}
+
+// Repairs returns the repairs a lenient decoder has made so far.
+func (d *Decoder) Repairs() []Repair {
+	return d.p.repairs
+}
+
+// DecodeLenient parses a TOON document with a lenient decoder and returns
+// the value with the repairs it needed.
+func DecodeLenient(data []byte) (interface{}, []Repair, error) {
+	dec := NewLenientDecoder(bytes.NewReader(data))
+	v, err := decode(dec)
+	return v, dec.Repairs(), err
+}
+
+// readAhead feeds the lines read by a lenient decoder one non-blank line
+// late, so that the parser knows when it reaches the last one.
+func (d *Decoder) readAhead(line string, eof bool) {
+	if strings.TrimSpace(line) != "" {
+		for _, held := range d.held {
+			d.p.recover(held)
+		}
+		d.held = d.held[:0]
+	}
+	if line != "" {
+		d.held = append(d.held, line)
+	}
+	if eof {
+		d.p.final = true
+		for _, held := range d.held {
+			d.p.recover(held)
+		}
+		d.held = nil
+	}
+}
+
+// parserState is a copy of the parser's state before a line, restored if
+// the line turns out to be unreadable.
+type parserState struct {
+	stack   []frame
+	pending *pendingKey
+	started bool
+	done    bool
+	levels  []int
+	repairs int
+}
+
+func (p *parser) save() parserState {
+	s := parserState{pending: p.pending, started: p.started, done: p.done,
+		levels: append([]int(nil), p.levels...), repairs: len(p.repairs)}
+	for _, f := range p.stack {
+		s.stack = append(s.stack, *f)
+	}
+	return s
+}
+
+func (p *parser) restore(s parserState) {
+	p.stack = p.stack[:0]
+	for i := range s.stack {
+		f := s.stack[i]
+		p.stack = append(p.stack, &f)
+	}
+	p.pending, p.started, p.done = s.pending, s.started, s.done
+	p.levels = s.levels
+	p.repairs = p.repairs[:s.repairs]
+}
+
+// recover feeds one line to a lenient parser. A line that cannot be read
+// is skipped as if it were not there, and its events are discarded.
+func (p *parser) recover(raw string) {
+	saved := p.save()
+	emit := p.emit
+	var events []Event
+	p.emit = func(ev Event) { events = append(events, ev) }
+	err := p.feed(raw)
+	p.emit = emit
+	if err == nil {
+		for _, ev := range events {
+			emit(ev)
+		}
+		return
+	}
+
+	p.restore(saved)
+	msg := err.Error()
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) {
+		msg = syntaxErr.Msg
+	}
+	if p.final {
+		p.repair("truncated", "", "dropped incomplete last line: %s", msg)
+	} else {
+		p.repair("skipped", "", "skipped line: %s", msg)
+	}
+}
+
+// level measures the indentation of a line for the lenient decoder. It
+// returns the length of the indentation in bytes and the depth of the
+// line: one level deeper than the closest enclosing line with less
+// indentation, however many spaces or tabs that is.
+func (p *parser) level(raw string) (indent, depth int) {
+	col, tabs := 0, false
+	for ; indent < len(raw) && (raw[indent] == ' ' || raw[indent] == '\t'); indent++ {
+		if raw[indent] == '\t' {
+			col += indentSize
+			tabs = true
+		} else {
+			col++
+		}
+	}
+	if tabs {
+		p.repair("indentation", "", "tab characters in indentation counted as %d spaces", indentSize)
+	}
+
+	for n := len(p.levels); n > 0 && p.levels[n-1] > col; n-- {
+		p.levels = p.levels[:n-1]
+	}
+	if n := len(p.levels); n == 0 || p.levels[n-1] < col {
+		p.levels = append(p.levels, col)
+		if depth := len(p.levels) - 1; col != depth*indentSize {
+			p.repair("indentation", "", "indentation of %d spaces read as depth %d", col, depth)
+		}
+	}
+	return indent, len(p.levels) - 1
+}
+
+// repair records a change made by the lenient decoder at the current line.
+func (p *parser) repair(kind, path, format string, args ...interface{}) {
+	p.repairs = append(p.repairs, Repair{Line: p.line, Kind: kind, Path: path, Msg: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,134 @@
+package toon
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDecodeLenient(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		repairs []string
+	}{
+		{
+			name:  "valid input needs no repairs",
+			input: "users[2]{id,name}:\n  1,Alice\n  2,Bob\n",
+			want:  `{"users":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}]}`,
+		},
+		{
+			name:  "truncated table",
+			input: "users[5]{id,name,score}:\n  1,Alice,90\n  2,Bob\n  3,Carol,70,x\n  4,Da",
+			want:  `{"users":[{"id":1,"name":"Alice","score":90},{"id":2,"name":"Bob","score":null},{"id":3,"name":"Carol","score":70}]}`,
+			repairs: []string{
+				"row line 3: .users[1]: row has 2 values but header declares 3 fields; missing fields set to null",
+				"row line 4: .users[2]: row has 4 values but header declares 3 fields; extra values dropped",
+				"truncated line 5: dropped incomplete last line: row has 2 values but header declares 3 fields",
+				"length line 5: .users: array declares 5 items but has 3",
+			},
+		},
+		{
+			name:  "more items than declared",
+			input: "[1]:\n  - a\n  - b\ntags[1]: x,y",
+			want:  `["a","b"]`,
+			repairs: []string{
+				"truncated line 4: dropped incomplete last line: unexpected content after root value",
+				"length line 4: .: array declares 1 items but has 2",
+			},
+		},
+		{
+			name:  "inline array and nested list",
+			input: "tags[3]: x,y\nitems[1]:\n  - a\n  - b\n",
+			want:  `{"tags":["x","y"],"items":["a","b"]}`,
+			repairs: []string{
+				"length line 1: .tags: array declares 3 items but has 2",
+				"length line 4: .items: array declares 1 items but has 2",
+			},
+		},
+		{
+			name:  "four-space and tab indentation",
+			input: "meta:\n    source: x\n    geo:\n\t\t\t\tlat: 1\nn: 2",
+			want:  `{"meta":{"source":"x","geo":{"lat":1}},"n":2}`,
+			repairs: []string{
+				"indentation line 2: indentation of 4 spaces read as depth 1",
+				"indentation line 4: tab characters in indentation counted as 2 spaces",
+				"indentation line 4: indentation of 8 spaces read as depth 2",
+			},
+		},
+		{
+			name:  "line indented too deep",
+			input: "a: 1\n  b: 2\nc: 3",
+			want:  `{"a":1,"b":2,"c":3}`,
+			repairs: []string{
+				"indentation line 2: line is indented deeper than its parent's other children",
+			},
+		},
+		{
+			name:  "last row cut after a delimiter",
+			input: "rows[2|]{a|b}:\n  1|2\n  3|",
+			want:  `{"rows":[{"a":1,"b":2}]}`,
+			repairs: []string{
+				"truncated line 3: dropped incomplete last line: row ends with a delimiter",
+				"length line 3: .rows: array declares 2 items but has 1",
+			},
+		},
+		{
+			name:  "malformed lines are skipped",
+			input: "a: 1\nthis is prose\nb: \"cut off",
+			want:  `{"a":1}`,
+			repairs: []string{
+				`skipped line 2: skipped line: missing ':' after key "this is prose"`,
+				"truncated line 3: dropped incomplete last line: unterminated string",
+			},
+		},
+		{
+			name:  "markers of omitted elements",
+			input: "rows[1]{id,name}:\n  1,a\n  # 4 more rows omitted\ntags[2]: x,y\n  # 1,200 more items omitted\nitems[1]:\n  - a\n  # 1 more item omitted\n",
+			want:  `{"rows":[{"id":1,"name":"a"}],"tags":["x","y"],"items":["a"]}`,
+			repairs: []string{
+				"skipped line 3: skipped line: comment marking omitted elements",
+				"skipped line 5: skipped line: comment marking omitted elements",
+				"skipped line 8: skipped line: comment marking omitted elements",
+			},
+		},
+		{
+			name:  "quoted value that looks like a marker is kept",
+			input: "notes[2]{t}:\n  \"# 2 more items omitted\"\n  b\n",
+			want:  `{"notes":[{"t":"# 2 more items omitted"},{"t":"b"}]}`,
+		},
+		{
+			name:  "trailing blank lines after a cut row",
+			input: "rows[2]{a,b}:\n  1,2\n  3\n\n",
+			want:  `{"rows":[{"a":1,"b":2}]}`,
+			repairs: []string{
+				"truncated line 3: dropped incomplete last line: row has 1 values but header declares 2 fields",
+				"length line 4: .rows: array declares 2 items but has 1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, repairs, err := DecodeLenient([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("DecodeLenient() error = %v", err)
+			}
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("DecodeLenient() = %s, want %s", got, tt.want)
+			}
+			var gotRepairs []string
+			for _, r := range repairs {
+				gotRepairs = append(gotRepairs, r.Kind+" "+r.String())
+			}
+			if strings.Join(gotRepairs, "\n") != strings.Join(tt.repairs, "\n") {
+				t.Errorf("repairs =\n%s\nwant\n%s", strings.Join(gotRepairs, "\n"), strings.Join(tt.repairs, "\n"))
+			}
+		})
+	}
+}